@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 )
@@ -17,10 +18,6 @@ func AssistConfigForRoot(cfg *config) error {
 		}
 	}
 
-	if err := verifyActiveProject(cfg.projectID); err != nil {
-		return err
-	}
-
 	return nil
 }
 
@@ -51,20 +48,33 @@ func AssistConfigForPoolCreate(cfg *config) error {
 		return err
 	}
 
-	if cfg.poolName == "" {
-		for {
-			cfg.poolName = GetInput("Enter new pool name (only letters, numbers, and hyphens allowed):")
-			if matched := strings.ContainsFunc(cfg.poolName, func(r rune) bool {
-				return !strings.ContainsRune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-", r)
-			}); matched {
-				fmt.Println("Invalid pool name. Only letters, numbers, and hyphens are allowed.")
-				continue
-			}
-			break
+	active, err := ListPools(cfg.projectID, false)
+	if err != nil {
+		return err
+	}
+	deleted, err := ListPools(cfg.projectID, true)
+	if err != nil {
+		return err
+	}
+	checkName := func(name string) error {
+		if err := ValidateResourceID("pool", name); err != nil {
+			return err
 		}
+		return checkDeletedNameCollision("pool", name, active, deleted)
 	}
 
-	return nil
+	if cfg.poolName != "" {
+		return checkName(cfg.poolName)
+	}
+	for {
+		name := GetInput("Enter new pool name (4-32 lowercase letters, numbers, and hyphens):")
+		if err := checkName(name); err != nil {
+			fmt.Println(err)
+			continue
+		}
+		cfg.poolName = name
+		return nil
+	}
 }
 
 func AssistConfigForProviderSubcommand(cfg *config) error {
@@ -94,15 +104,33 @@ func AssistConfigForProviderCreate(cfg *config) error {
 		return err
 	}
 
-	if cfg.providerName == "" {
+	active, err := ListProviders(cfg.projectID, cfg.poolName, false)
+	if err != nil {
+		return err
+	}
+	deleted, err := ListProviders(cfg.projectID, cfg.poolName, true)
+	if err != nil {
+		return err
+	}
+	checkName := func(name string) error {
+		if err := ValidateResourceID("provider", name); err != nil {
+			return err
+		}
+		return checkDeletedNameCollision("provider", name, active, deleted)
+	}
+
+	if cfg.providerName != "" {
+		if err := checkName(cfg.providerName); err != nil {
+			return err
+		}
+	} else {
 		for {
-			cfg.providerName = GetInput("Enter new provider name (only letters, numbers, and hyphens allowed):")
-			if matched := strings.ContainsFunc(cfg.providerName, func(r rune) bool {
-				return !strings.ContainsRune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-", r)
-			}); matched {
-				fmt.Println("Invalid provider name. Only letters, numbers, and hyphens are allowed.")
+			name := GetInput("Enter new provider name (4-32 lowercase letters, numbers, and hyphens):")
+			if err := checkName(name); err != nil {
+				fmt.Println(err)
 				continue
 			}
+			cfg.providerName = name
 			break
 		}
 	}
@@ -132,6 +160,11 @@ func AssistConfigForProviderDelete(cfg *config) error {
 	return nil
 }
 
+// AssistConfigForProviderDescribe selects an active provider, the same way as for deletion
+func AssistConfigForProviderDescribe(cfg *config) error {
+	return AssistConfigForProviderDelete(cfg)
+}
+
 func AssistConfigForProviderRestore(cfg *config) error {
 	if err := AssistConfigForProviderSubcommand(cfg); err != nil {
 		return err
@@ -189,15 +222,7 @@ func AssistConfigForAuth(cfg *config) error {
 	}
 
 	if cfg.serviceAccount == "" {
-		accounts, err := ListServiceAccounts(cfg.projectID)
-		if err != nil {
-			return err
-		}
-		if len(accounts) == 0 {
-			return fmt.Errorf("no service accounts found in project %s", cfg.projectID)
-		}
-		cfg.serviceAccount, err = SelectFromList(accounts, "service accounts")
-		if err != nil {
+		if err := assistServiceAccount(cfg); err != nil {
 			return err
 		}
 	}
@@ -240,15 +265,7 @@ func AssistConfigForYaml(cfg *config) error {
 	}
 
 	if cfg.serviceAccount == "" {
-		accounts, err := ListServiceAccounts(cfg.projectID)
-		if err != nil {
-			return err
-		}
-		if len(accounts) == 0 {
-			return fmt.Errorf("no service accounts found in project %s", cfg.projectID)
-		}
-		cfg.serviceAccount, err = SelectFromList(accounts, "service accounts")
-		if err != nil {
+		if err := assistServiceAccount(cfg); err != nil {
 			return err
 		}
 	}
@@ -257,27 +274,200 @@ func AssistConfigForYaml(cfg *config) error {
 }
 
 func AssistGithub(cfg *config) error {
-	if cfg.githubRepositoryOwner == "" {
-		for {
-			cfg.githubRepositoryOwner = GetInput("Enter GitHub repository owner [CASE SENSITIVE]:")
-			if cfg.githubRepositoryOwner == "" {
-				fmt.Println("GitHub repository owner is required.")
-				continue
-			}
-			break
+	assistGithubOwner(cfg)
+
+	if cfg.orgProvider {
+		if cfg.githubRepository != "" {
+			return fmt.Errorf("--repo can't be used with --org, org providers admit every repository of the owner")
 		}
+		return AssistGithubOwnerID(cfg, NewGitHubClient())
 	}
 
-	if cfg.githubRepository == "" {
-		for {
-			cfg.githubRepository = GetInput("Enter GitHub repository name [CASE SENSITIVE]:")
-			if cfg.githubRepository == "" {
-				fmt.Println("GitHub repository name is required.")
-				continue
+	assistGithubRepository(cfg)
+	return AssistGithubIDs(cfg, NewGitHubClient())
+}
+
+// AssistGithubForStatus asks for the repository and looks up its numeric IDs without prompting,
+// status only reads the configuration so missing IDs are skipped
+func AssistGithubForStatus(cfg *config) error {
+	assistGithubOwner(cfg)
+	assistGithubRepository(cfg)
+	return LookupGithubIDs(cfg, NewGitHubClient())
+}
+
+func assistGithubOwner(cfg *config) {
+	for cfg.githubRepositoryOwner == "" {
+		cfg.githubRepositoryOwner = GetInput("Enter GitHub repository owner [CASE SENSITIVE]:")
+		if cfg.githubRepositoryOwner == "" {
+			fmt.Println("GitHub repository owner is required.")
+		}
+	}
+}
+
+func assistGithubRepository(cfg *config) {
+	for cfg.githubRepository == "" {
+		cfg.githubRepository = GetInput("Enter GitHub repository name [CASE SENSITIVE]:")
+		if cfg.githubRepository == "" {
+			fmt.Println("GitHub repository name is required.")
+		}
+	}
+}
+
+// AssistGithubOwnerID resolves the numeric owner ID used to pin the condition of an org provider
+func AssistGithubOwnerID(cfg *config, client GitHubClient) error {
+	if cfg.githubRepositoryOwnerID != "" {
+		if !isNumericID(cfg.githubRepositoryOwnerID) {
+			return fmt.Errorf("invalid GitHub owner ID: %s", cfg.githubRepositoryOwnerID)
+		}
+		return nil
+	}
+
+	ownerID, err := client.OwnerID(cfg.githubRepositoryOwner)
+	if err != nil {
+		fmt.Println(err)
+		fmt.Println("WARNING: Without the numeric ID the provider is pinned by owner name only - a renamed owner can be reclaimed by someone else.")
+		fmt.Println("Pass --owner-id to pin the provider by ID.")
+		if !Ask("Continue without the numeric owner ID?") {
+			return fmt.Errorf("cannot continue without GitHub IDs")
+		}
+		return nil
+	}
+	cfg.githubRepositoryOwnerID = ownerID
+	return nil
+}
+
+// AssistGithubIDs resolves the numeric owner and repository IDs used to pin the provider condition.
+// IDs supplied by flag are kept as they are.
+func AssistGithubIDs(cfg *config, client GitHubClient) error {
+	err := lookupGithubIDs(cfg, client)
+	var lookupErr *githubLookupError
+	if !errors.As(err, &lookupErr) {
+		return err
+	}
+	fmt.Println(lookupErr.err)
+	fmt.Println("WARNING: Without numeric IDs the provider is pinned by name only - a renamed owner or repository can be reclaimed by someone else.")
+	fmt.Println("Set GITHUB_TOKEN for private repositories, or pass --owner-id and --repo-id.")
+	if !Ask("Continue without numeric IDs?") {
+		return fmt.Errorf("cannot continue without GitHub IDs")
+	}
+	return nil
+}
+
+// LookupGithubIDs resolves the numeric owner and repository IDs like AssistGithubIDs, but skips them
+// with a note when GitHub can't resolve them
+func LookupGithubIDs(cfg *config, client GitHubClient) error {
+	err := lookupGithubIDs(cfg, client)
+	var lookupErr *githubLookupError
+	if !errors.As(err, &lookupErr) {
+		return err
+	}
+	fmt.Printf("NOTE: Numeric IDs not resolved (%v) - conditions on them are shown as unknown. Set GITHUB_TOKEN or pass --owner-id and --repo-id.\n", lookupErr.err)
+	return nil
+}
+
+// githubLookupError is a failed GitHub ID lookup, which callers may continue past
+type githubLookupError struct {
+	err error
+}
+
+func (e *githubLookupError) Error() string {
+	return e.err.Error()
+}
+
+func lookupGithubIDs(cfg *config, client GitHubClient) error {
+	if cfg.githubRepositoryOwnerID != "" && !isNumericID(cfg.githubRepositoryOwnerID) {
+		return fmt.Errorf("invalid GitHub owner ID: %s", cfg.githubRepositoryOwnerID)
+	}
+	if cfg.githubRepositoryID != "" && !isNumericID(cfg.githubRepositoryID) {
+		return fmt.Errorf("invalid GitHub repository ID: %s", cfg.githubRepositoryID)
+	}
+	if cfg.githubRepositoryOwnerID != "" && cfg.githubRepositoryID != "" {
+		return nil
+	}
+
+	ownerID, repoID, err := client.RepositoryIDs(cfg.githubRepositoryOwner, cfg.githubRepository)
+	if err != nil {
+		return &githubLookupError{err: err}
+	}
+
+	if cfg.githubRepositoryOwnerID == "" {
+		cfg.githubRepositoryOwnerID = ownerID
+	}
+	if cfg.githubRepositoryID == "" {
+		cfg.githubRepositoryID = repoID
+	}
+	return nil
+}
+
+// AssistConfigForExport selects an active pool, the same way as for deletion
+func AssistConfigForExport(cfg *config) error {
+	return AssistConfigForPoolDelete(cfg)
+}
+
+// AssistConfigForOnboard selects the active pool the repositories are onboarded to
+func AssistConfigForOnboard(cfg *config) error {
+	return AssistConfigForPoolDelete(cfg)
+}
+
+func AssistConfigForCopy(cfg *config) error {
+	if cfg.fromProject == "" || cfg.toProject == "" {
+		projects, err := ListProjects()
+		if err != nil {
+			return err
+		}
+		if cfg.fromProject == "" {
+			if cfg.fromProject, err = SelectFromList(projects, "projects to copy from"); err != nil {
+				return err
+			}
+		}
+		if cfg.toProject == "" {
+			if cfg.toProject, err = SelectFromList(projects, "projects to copy to"); err != nil {
+				return err
 			}
-			break
 		}
 	}
+	if cfg.fromProject == cfg.toProject {
+		return fmt.Errorf("source and destination project are both %s", cfg.fromProject)
+	}
 
+	if cfg.poolName == "" {
+		pools, err := ListPools(cfg.fromProject, false)
+		if err != nil {
+			return err
+		}
+		if len(pools) == 0 {
+			return fmt.Errorf("no workload identity pools found in project %s", cfg.fromProject)
+		}
+		if cfg.poolName, err = SelectFromList(pools, "workload identity pools"); err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+// assistServiceAccount lets the user pick a service account of the pool's project or the
+// --service-account-project projects
+func assistServiceAccount(cfg *config) error {
+	projects := bindingProjects(cfg)
+	var accounts []string
+	for _, project := range projects {
+		projectAccounts, err := ListServiceAccounts(project)
+		if err != nil {
+			return err
+		}
+		accounts = append(accounts, projectAccounts...)
+	}
+	if len(accounts) == 0 {
+		return fmt.Errorf("no service accounts found in project %s", strings.Join(projects, ", "))
+	}
+	var err error
+	cfg.serviceAccount, err = SelectFromList(accounts, "service accounts")
+	return err
+}
+
+// serviceAccountProjectID returns the project holding the service account, which can differ from the
+// pool's project when a central pool is used. It is taken from the service account email, falling
+// back to the pool's project.
+func serviceAccountProjectID(cfg *config) string {
+	return serviceAccountEmailProject(cfg.serviceAccount, cfg.projectID)
+}
@@ -2,10 +2,40 @@ package main
 
 import (
 	"fmt"
-	"os"
-	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	celast "github.com/google/cel-go/common/ast"
+	"github.com/google/cel-go/common/operators"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/parser"
 )
 
+// bindingAttribute is a mapped provider attribute that a service account can be associated with
+type bindingAttribute struct {
+	name     string
+	label    string
+	format   string
+	examples []string
+	// repositoryScoped attributes only match jobs of one repository, as required by org providers
+	repositoryScoped bool
+}
+
+var bindingAttributes = []bindingAttribute{
+	{name: "workflow", label: "workflow [SUGGESTED]", format: "workflow-filename (without .yml)", examples: []string{"build", "deploy"}},
+	{name: "repository", label: "repository", format: "owner/repo", examples: []string{"unacast/actions", "redis/go-redis"}, repositoryScoped: true},
+	{name: "repository_id", label: "repository_id [rename safe]", format: "owner/repo or numeric repository ID", examples: []string{"unacast/actions", "123456789"}, repositoryScoped: true},
+	{name: "repository_owner_id", label: "repository_owner_id [rename safe]", format: "owner or numeric owner ID", examples: []string{"unacast", "1234567"}},
+	{name: "job_workflow", label: "job_workflow (reusable workflow)", format: "owner/repo/.github/workflows/file.yml@ref", examples: []string{"unacast/shared-workflows/.github/workflows/deploy.yml@refs/heads/main", "unacast/shared-workflows/.github/workflows/deploy.yml@refs/tags/v1"}},
+	{name: "environment", label: "environment", format: "env", examples: []string{"dev", "prod"}},
+	{name: "actor", label: "actor", format: "username"},
+	{name: "ref", label: "ref", format: "refs/heads/branch-name", examples: []string{"refs/heads/main", "refs/heads/feature-branch"}},
+	{name: "repo_workflow", label: "repo_workflow (repository + workflow)", format: "owner/repo/workflow-filename (without .yml)", examples: []string{"unacast/actions/deploy"}, repositoryScoped: true},
+	{name: "repo_env", label: "repo_env (repository + environment)", format: "owner/repo/env", examples: []string{"unacast/actions/prod"}, repositoryScoped: true},
+	{name: "repo_ref", label: "repo_ref (repository + ref)", format: "owner/repo/refs/heads/branch-name", examples: []string{"unacast/actions/refs/heads/main"}, repositoryScoped: true},
+}
+
 func AuthServiceAccount(cfg *config, projectNumber string) error {
 	fmt.Printf(`
 
@@ -22,71 +52,298 @@ func AuthServiceAccount(cfg *config, projectNumber string) error {
 	if cfg.serviceAccount == "" {
 		cfg.serviceAccount = GetInput("Paste the service account email address (e.g. deploy-sa@project-id.iam.gserviceaccount.com):")
 	}
+
+	provider, err := GetProvider(cfg.projectID, cfg.poolName, cfg.providerName)
+	if err != nil {
+		return err
+	}
+	attributes := bindingAttributes
+	if !pinsRepository(provider.AttributeCondition) {
+		fmt.Println()
+		fmt.Printf("NOTE: Provider %s admits every repository of the owner (org provider), so the service account\n", cfg.providerName)
+		fmt.Println("      must be bound by an attribute that names the repository.")
+		attributes = repositoryScopedAttributes()
+	}
+
 	fmt.Println()
-	fmt.Printf(`Select the attribute to use for service account association:
-1. workflow [SUGGESTED]
-2. repository
-3. environment
-4. actor
-5. ref
-`)
+	fmt.Println("Select the attribute to use for service account association:")
+	for i, attr := range attributes {
+		fmt.Printf("%d. %s\n", i+1, attr.label)
+	}
 
-	attributeNum := GetInput("Enter number (1-5):")
-	var attribute string
-	switch attributeNum {
-	case "1":
-		attribute = "workflow"
-	case "2":
-		attribute = "repository"
-	case "3":
-		attribute = "environment"
-	case "4":
-		attribute = "actor"
-	case "5":
-		attribute = "ref"
-	default:
+	attributeNum := GetInput(fmt.Sprintf("Enter number (1-%d):", len(attributes)))
+	var num int
+	if _, err := fmt.Sscanf(attributeNum, "%d", &num); err != nil || num < 1 || num > len(attributes) {
 		return fmt.Errorf("invalid selection: %s", attributeNum)
 	}
+	attr := attributes[num-1]
+	if _, ok := provider.AttributeMapping["attribute."+attr.name]; !ok {
+		return fmt.Errorf("provider %s does not map attribute.%s, so a binding on it would never match - recreate the provider with gwif providers create", cfg.providerName, attr.name)
+	}
 
 	fmt.Println()
-	switch attribute {
-	case "repository":
-		fmt.Println("Expected format for [repository]: owner/repo")
-		fmt.Println()
-		fmt.Println("Examples:")
-		fmt.Println("- unacast/actions")
-		fmt.Println("- redis/go-redis")
-	case "environment":
-		fmt.Println("Expected format for [environment]: env")
+	fmt.Printf("Expected format for [%s]: %s\n", attr.name, attr.format)
+	if len(attr.examples) > 0 {
 		fmt.Println()
 		fmt.Println("Examples:")
-		fmt.Println("- dev")
-		fmt.Println("- prod")
-	case "workflow":
-		fmt.Println("Expected format for [workflow]: workflow-filename (without .yml)")
+		for _, example := range attr.examples {
+			fmt.Println("- " + example)
+		}
+	}
+	if strings.HasSuffix(attr.name, "_id") {
 		fmt.Println()
-		fmt.Println("Examples:")
-		fmt.Println("- build")
-		fmt.Println("- deploy")
-	case "actor":
-		fmt.Println("Expected format for [actor]: username")
-	case "ref":
-		fmt.Println("Expected format for [ref]: refs/heads/branch-name")
+		fmt.Println("NOTE: ID attributes are only mapped by providers created with repository_id and repository_owner_id mappings.")
+	}
+	if attr.name == "job_workflow" {
 		fmt.Println()
-		fmt.Println("Examples:")
-		fmt.Println("- refs/heads/main")
-		fmt.Println("- refs/heads/feature-branch")
+		fmt.Println("NOTE: job_workflow is the workflow that actually runs the job. For jobs calling a reusable workflow")
+		fmt.Println("      it points at the reusable workflow, while workflow points at the caller.")
 	}
 
 	value := GetInput("Enter value [CASE SENSITIVE]:")
+	var condition *IAMCondition
+	if !cfg.expiresAt.IsZero() {
+		condition = expiryCondition(cfg.expiresAt)
+		fmt.Printf("The binding expires at %s\n", cfg.expiresAt.UTC().Format(time.RFC3339))
+	}
+	_, err = addAttributeBinding(serviceAccountProjectID(cfg), cfg.serviceAccount, projectNumber, cfg.poolName, attr.name, value, condition, NewGitHubClient())
+	return err
+}
+
+// pinsRepository reports whether a provider condition restricts the repository, i.e. requires
+// assertion.repository or assertion.repository_id to equal a literal in a top-level && clause.
+// Providers that don't, like org providers, admit every repository of the owner.
+func pinsRepository(condition string) bool {
+	return slices.ContainsFunc(conditionPins(condition), func(pin claimPin) bool {
+		return pin.claim == "repository" || pin.claim == "repository_id"
+	})
+}
+
+// claimPin is a top-level clause of a condition requiring a claim to equal a string literal
+type claimPin struct {
+	claim string
+	value string
+}
+
+// conditionPins returns the claims a condition requires to equal a string literal in top-level && clauses,
+// or nothing when the condition doesn't parse
+func conditionPins(condition string) []claimPin {
+	env, err := newCELEnv(true)
+	if err != nil {
+		return nil
+	}
+	ast, iss := env.Parse(condition)
+	if iss.Err() != nil {
+		return nil
+	}
+	var pins []claimPin
+	for _, clause := range celConjuncts(ast.NativeRep().Expr()) {
+		if clause.Kind() != celast.CallKind || clause.AsCall().FunctionName() != operators.Equals {
+			continue
+		}
+		args := clause.AsCall().Args()
+		if pin, ok := claimEquality(args[0], args[1]); ok {
+			pins = append(pins, pin)
+		} else if pin, ok := claimEquality(args[1], args[0]); ok {
+			pins = append(pins, pin)
+		}
+	}
+	return pins
+}
 
-	cmd := exec.Command("gcloud", "iam", "service-accounts", "add-iam-policy-binding",
-		cfg.serviceAccount,
-		"--project", cfg.projectID,
-		"--role", "roles/iam.workloadIdentityUser",
-		"--member", fmt.Sprintf("principalSet://iam.googleapis.com/projects/%s/locations/global/workloadIdentityPools/%s/attribute.%s/%s",
-			projectNumber, cfg.poolName, attribute, value))
+// celConjuncts returns the clauses joined by && at the top level of e
+func celConjuncts(e celast.Expr) []celast.Expr {
+	if e.Kind() == celast.CallKind && e.AsCall().FunctionName() == operators.LogicalAnd {
+		var clauses []celast.Expr
+		for _, arg := range e.AsCall().Args() {
+			clauses = append(clauses, celConjuncts(arg)...)
+		}
+		return clauses
+	}
+	return []celast.Expr{e}
+}
+
+// conditionClauses returns the clauses joined by && at the top level of a condition in a canonical
+// form, or nothing when the condition doesn't parse
+func conditionClauses(condition string) []string {
+	env, err := newCELEnv(true)
+	if err != nil {
+		return nil
+	}
+	ast, iss := env.Parse(condition)
+	if iss.Err() != nil {
+		return nil
+	}
+	var clauses []string
+	for _, clause := range celConjuncts(ast.NativeRep().Expr()) {
+		if s, err := parser.Unparse(clause, ast.NativeRep().SourceInfo()); err == nil {
+			clauses = append(clauses, s)
+		}
+	}
+	return clauses
+}
 
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
+func claimEquality(claim, value celast.Expr) (claimPin, bool) {
+	if claim.Kind() != celast.SelectKind || value.Kind() != celast.LiteralKind {
+		return claimPin{}, false
+	}
+	sel := claim.AsSelect()
+	if sel.Operand().Kind() != celast.IdentKind || sel.Operand().AsIdent() != "assertion" {
+		return claimPin{}, false
+	}
+	s, ok := value.AsLiteral().(types.String)
+	return claimPin{claim: sel.FieldName(), value: string(s)}, ok
+}
+
+func repositoryScopedAttributes() []bindingAttribute {
+	var attributes []bindingAttribute
+	for _, attr := range bindingAttributes {
+		if attr.repositoryScoped {
+			attributes = append(attributes, attr)
+		}
+	}
+	return attributes
+}
+
+// checkOrgProviderAttribute rejects binding attributes that would let any repository of the owner use the
+// service account when the provider doesn't restrict the repository
+func checkOrgProviderAttribute(provider *Provider, attribute string) error {
+	if pinsRepository(provider.AttributeCondition) {
+		return nil
+	}
+	if slices.ContainsFunc(repositoryScopedAttributes(), func(a bindingAttribute) bool { return a.name == attribute }) {
+		return nil
+	}
+	var names []string
+	for _, attr := range repositoryScopedAttributes() {
+		names = append(names, attr.name)
+	}
+	return fmt.Errorf("provider %s does not restrict the repository, bind by %s instead of %s", provider.ID(), strings.Join(names, ", "), attribute)
+}
+
+// addAttributeBinding lets identities of the pool with the attribute value use the service account,
+// resolving owner and repository names for the ID attributes. It returns the bound principal.
+// condition limits the binding, e.g. to expire it, and may be nil.
+func addAttributeBinding(accountProject, serviceAccount, projectNumber, poolName, attribute, value string, condition *IAMCondition, client GitHubClient) (string, error) {
+	value, err := resolveBindingValue(attribute, value, client)
+	if err != nil {
+		return "", err
+	}
+	switch attribute {
+	case "job_workflow":
+		if err := validateJobWorkflowRef(value); err != nil {
+			return "", err
+		}
+	case "repo_workflow", "repo_env", "repo_ref":
+		if err := validateRepositoryValue(attribute, value); err != nil {
+			return "", err
+		}
+	}
+
+	member := attributeMember(projectNumber, poolName, attribute, value)
+	conditionArgs, cleanup, err := bindingConditionArgs(condition)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+	cmd := gcloudCommand(append(addBindingArgs(accountProject, serviceAccount, workloadIdentityUserRole, member), conditionArgs...)...)
+	if err := runGcloud("add service account binding", cmd); err != nil {
+		return "", err
+	}
+	return member, nil
+}
+
+// attributeMember returns the principalSet member selecting identities of a pool by a mapped attribute
+func attributeMember(projectNumber, poolName, attribute, value string) string {
+	return fmt.Sprintf("principalSet://iam.googleapis.com/projects/%s/locations/global/workloadIdentityPools/%s/attribute.%s/%s",
+		projectNumber, poolName, attribute, value)
+}
+
+// addBindingArgs returns the gcloud arguments granting member a role on a service account
+func addBindingArgs(projectID, serviceAccount, role, member string) []string {
+	return []string{"iam", "service-accounts", "add-iam-policy-binding",
+		serviceAccount,
+		"--project", projectID,
+		"--role", role,
+		"--member", member}
+}
+
+// resolveBindingValue turns owner and owner/repo names into numeric IDs for the ID attributes
+func resolveBindingValue(attribute, value string, client GitHubClient) (string, error) {
+	if isNumericID(value) {
+		return value, nil
+	}
+
+	switch attribute {
+	case "repository_id":
+		owner, repo, ok := strings.Cut(value, "/")
+		if !ok || owner == "" || repo == "" {
+			return "", fmt.Errorf("invalid repository: %s (expected owner/repo)", value)
+		}
+		_, repoID, err := client.RepositoryIDs(owner, repo)
+		if err != nil {
+			return "", err
+		}
+		fmt.Printf("Resolved %s to repository ID %s\n", value, repoID)
+		return repoID, nil
+	case "repository_owner_id":
+		ownerID, err := client.OwnerID(value)
+		if err != nil {
+			return "", err
+		}
+		fmt.Printf("Resolved %s to owner ID %s\n", value, ownerID)
+		return ownerID, nil
+	}
+	return value, nil
+}
+
+// validateRepositoryValue checks the owner/repo/... format of the composite repository attributes
+func validateRepositoryValue(attribute, value string) error {
+	parts := strings.SplitN(value, "/", 3)
+	if len(parts) != 3 || slices.Contains(parts, "") {
+		return fmt.Errorf("invalid %s %s: expected owner/repo/... (e.g. %s)", attribute, value, repositoryValueExample(attribute))
+	}
+	switch name := parts[2]; attribute {
+	case "repo_workflow":
+		if strings.HasSuffix(name, ".yml") || strings.HasSuffix(name, ".yaml") {
+			return fmt.Errorf("invalid repo_workflow %s: use the workflow file name without .yml or .yaml", value)
+		}
+		// The mapping cuts the file name at the first dot and workflows can't be in subdirectories
+		if strings.ContainsAny(name, "./") {
+			return fmt.Errorf("invalid repo_workflow %s: expected owner/repo/workflow-filename without extension", value)
+		}
+	case "repo_ref":
+		if !strings.HasPrefix(name, "refs/") {
+			return fmt.Errorf("invalid repo_ref %s: the ref must be fully qualified, e.g. owner/repo/refs/heads/main", value)
+		}
+	}
+	return nil
+}
+
+func repositoryValueExample(attribute string) string {
+	for _, attr := range bindingAttributes {
+		if attr.name == attribute && len(attr.examples) > 0 {
+			return attr.examples[0]
+		}
+	}
+	return "owner/repo/value"
+}
+
+// validateJobWorkflowRef checks the owner/repo/.github/workflows/file.yml@ref format of a job_workflow_ref claim
+func validateJobWorkflowRef(value string) error {
+	path, ref, ok := strings.Cut(value, "@")
+	if !ok || ref == "" {
+		return fmt.Errorf("invalid job workflow %s: missing @ref (e.g. @refs/heads/main)", value)
+	}
+	repo, file, ok := strings.Cut(path, "/.github/workflows/")
+	if !ok || strings.Count(repo, "/") != 1 || file == "" {
+		return fmt.Errorf("invalid job workflow %s: expected owner/repo/.github/workflows/file.yml@ref", value)
+	}
+	if !strings.HasSuffix(file, ".yml") && !strings.HasSuffix(file, ".yaml") {
+		return fmt.Errorf("invalid job workflow %s: workflow file must end in .yml or .yaml", value)
+	}
+	if !strings.HasPrefix(ref, "refs/") {
+		fmt.Printf("WARNING: ref %s is not fully qualified - GitHub issues job_workflow_ref with refs/heads/... or refs/tags/... unless the reusable workflow is called by SHA\n", ref)
+	}
+	return nil
 }
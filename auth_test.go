@@ -0,0 +1,91 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPinsRepository(t *testing.T) {
+	tests := []struct {
+		condition string
+		want      bool
+	}{
+		{`assertion.repository_owner_id=='7' && assertion.repository_id=='42'`, true},
+		{`assertion.repository_owner=='acme' && assertion.repository=='acme/api'`, true},
+		{`'acme/api' == assertion.repository`, true},
+		{`assertion.repository=='acme/api' && assertion.ref=='refs/heads/main' && assertion.event_name!='pull_request'`, true},
+		{`(assertion.repository_owner=='acme' && assertion.repository=='acme/api') && assertion.ref=='refs/heads/main'`, true},
+
+		// Org providers and conditions that mention the repository without pinning it
+		{`assertion.repository_owner_id=='7'`, false},
+		{`assertion.repository_owner=='acme'`, false},
+		{`assertion.repository_owner=='acme' && assertion.repository != 'acme/x'`, false},
+		{`assertion.repository_owner=='acme' && assertion.repository.startsWith('acme/')`, false},
+		{`assertion.repository=='acme/api' || assertion.repository_owner=='acme'`, false},
+		{`assertion.repository in ['acme/api', 'acme/web']`, false},
+		{`!(assertion.repository == 'acme/api')`, false},
+		{`assertion.repository == assertion.repository_owner + '/api'`, false},
+		{`attribute.repository == 'acme/api'`, false},
+		{`assertion.repository_owner=='acme' && (assertion.repository == 'acme/api' || true)`, false},
+		{`not valid cel ==`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.condition, func(t *testing.T) {
+			if got := pinsRepository(tt.condition); got != tt.want {
+				t.Errorf("pinsRepository(%q) = %v, want %v", tt.condition, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckOrgProviderAttribute(t *testing.T) {
+	org := &Provider{Name: "projects/1/locations/global/workloadIdentityPools/pool/providers/acme", AttributeCondition: `assertion.repository_owner=='acme' && assertion.repository != 'acme/x'`}
+	pinned := &Provider{Name: "projects/1/locations/global/workloadIdentityPools/pool/providers/api", AttributeCondition: `assertion.repository_id=='42'`}
+
+	for _, attribute := range []string{"repository", "repository_id", "repo_workflow", "repo_env", "repo_ref"} {
+		if err := checkOrgProviderAttribute(org, attribute); err != nil {
+			t.Errorf("checkOrgProviderAttribute(org, %s) failed: %v", attribute, err)
+		}
+	}
+	for _, attribute := range []string{"workflow", "environment", "ref", "actor", "job_workflow", "repository_owner_id"} {
+		err := checkOrgProviderAttribute(org, attribute)
+		if err == nil || !strings.Contains(err.Error(), "does not restrict the repository") {
+			t.Errorf("checkOrgProviderAttribute(org, %s) error = %v, want a repository restriction error", attribute, err)
+		}
+		if err := checkOrgProviderAttribute(pinned, attribute); err != nil {
+			t.Errorf("checkOrgProviderAttribute(pinned, %s) failed: %v", attribute, err)
+		}
+	}
+}
+
+func TestValidateRepositoryValue(t *testing.T) {
+	tests := []struct {
+		attribute string
+		value     string
+		wantErr   string
+	}{
+		{"repo_workflow", "acme/api/deploy", ""},
+		{"repo_workflow", "acme/api/deploy.yml", "without .yml"},
+		{"repo_workflow", "acme/api/deploy.yaml", "without .yml"},
+		{"repo_workflow", "acme/api/ci/deploy", "without extension"},
+		{"repo_workflow", "api/deploy", "expected owner/repo/"},
+		{"repo_workflow", "acme//deploy", "expected owner/repo/"},
+		{"repo_env", "acme/api/prod", ""},
+		{"repo_env", "prod", "expected owner/repo/"},
+		{"repo_env", "acme/api/", "expected owner/repo/"},
+		{"repo_ref", "acme/api/refs/heads/main", ""},
+		{"repo_ref", "acme/api/main", "fully qualified"},
+		{"repo_ref", "api/refs/heads/main", "fully qualified"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.attribute+"="+tt.value, func(t *testing.T) {
+			err := validateRepositoryValue(tt.attribute, tt.value)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+const workloadIdentityUserRole = "roles/iam.workloadIdentityUser"
+
+// IAMPolicy is an IAM policy as returned by gcloud get-iam-policy
+type IAMPolicy struct {
+	Bindings []IAMBinding `json:"bindings"`
+	Etag     string       `json:"etag"`
+	Version  int          `json:"version"`
+}
+
+type IAMBinding struct {
+	Role      string        `json:"role"`
+	Members   []string      `json:"members"`
+	Condition *IAMCondition `json:"condition,omitempty"`
+}
+
+type IAMCondition struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Expression  string `json:"expression"`
+}
+
+// WorkloadPrincipal is a parsed principal:// or principalSet:// member of a workload identity pool
+type WorkloadPrincipal struct {
+	ProjectNumber string
+	Pool          string
+	// Kind is one of subject, attribute, group or all
+	Kind      string
+	Attribute string
+	Value     string
+}
+
+// ServiceAccountBinding is a workload identity member granted a role on a service account
+type ServiceAccountBinding struct {
+	ServiceAccount string
+	Role           string
+	Member         string
+	Principal      WorkloadPrincipal
+	Condition      *IAMCondition
+}
+
+const workloadPrincipalPrefix = "//iam.googleapis.com/projects/"
+
+// ParseWorkloadPrincipal parses members like
+// principalSet://iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/pool/attribute.workflow/deploy
+func ParseWorkloadPrincipal(member string) (WorkloadPrincipal, bool) {
+	scheme, rest, ok := strings.Cut(member, ":")
+	if !ok || (scheme != "principal" && scheme != "principalSet") || !strings.HasPrefix(rest, workloadPrincipalPrefix) {
+		return WorkloadPrincipal{}, false
+	}
+	parts := strings.SplitN(strings.TrimPrefix(rest, workloadPrincipalPrefix), "/", 6)
+	if len(parts) < 6 || parts[1] != "locations" || parts[3] != "workloadIdentityPools" {
+		return WorkloadPrincipal{}, false
+	}
+
+	p := WorkloadPrincipal{ProjectNumber: parts[0], Pool: parts[4]}
+	selector := parts[5]
+	switch {
+	case scheme == "principal" && strings.HasPrefix(selector, "subject/"):
+		p.Kind = "subject"
+		p.Value = strings.TrimPrefix(selector, "subject/")
+	case scheme == "principalSet" && selector == "*":
+		p.Kind = "all"
+	case scheme == "principalSet" && strings.HasPrefix(selector, "group/"):
+		p.Kind = "group"
+		p.Value = strings.TrimPrefix(selector, "group/")
+	case scheme == "principalSet" && strings.HasPrefix(selector, "attribute."):
+		attribute, value, ok := strings.Cut(strings.TrimPrefix(selector, "attribute."), "/")
+		if !ok {
+			return WorkloadPrincipal{}, false
+		}
+		p.Kind = "attribute"
+		p.Attribute = attribute
+		p.Value = value
+	default:
+		return WorkloadPrincipal{}, false
+	}
+	return p, true
+}
+
+// String describes what the principal selects, e.g. attribute.workflow=deploy
+func (p WorkloadPrincipal) String() string {
+	switch p.Kind {
+	case "subject":
+		return "subject=" + p.Value
+	case "group":
+		return "group=" + p.Value
+	case "all":
+		return "all identities in pool"
+	}
+	return fmt.Sprintf("attribute.%s=%s", p.Attribute, p.Value)
+}
+
+// Matches reports whether an identity with the given subject and mapped attributes is selected by the principal
+func (p WorkloadPrincipal) Matches(subject string, attributes map[string]any) bool {
+	switch p.Kind {
+	case "all":
+		return true
+	case "subject":
+		return subject == p.Value
+	case "attribute":
+		v, ok := attributes[p.Attribute].(string)
+		return ok && v == p.Value
+	}
+	return false
+}
+
+// GetServiceAccountPolicy returns the IAM policy set on a service account
+func GetServiceAccountPolicy(projectID, serviceAccount string) (*IAMPolicy, error) {
+	return GetServiceAccountPolicyContext(context.Background(), projectID, serviceAccount)
+}
+
+// GetServiceAccountPolicyContext is GetServiceAccountPolicy with a context that kills gcloud when done
+func GetServiceAccountPolicyContext(ctx context.Context, projectID, serviceAccount string) (*IAMPolicy, error) {
+	cmd := gcloudCommandContext(ctx, "iam", "service-accounts", "get-iam-policy",
+		serviceAccount,
+		"--project", projectID,
+		"--format", "json")
+	output, err := outputGcloud("get IAM policy for "+serviceAccount, cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	var policy IAMPolicy
+	if err := json.Unmarshal(output, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse IAM policy for %s: %v", serviceAccount, err)
+	}
+	return &policy, nil
+}
+
+// GetProjectPolicy returns the IAM policy set on a project
+func GetProjectPolicy(projectID string) (*IAMPolicy, error) {
+	cmd := gcloudCommand("projects", "get-iam-policy", projectID, "--format", "json")
+	output, err := outputGcloud("get IAM policy for project "+projectID, cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	var policy IAMPolicy
+	if err := json.Unmarshal(output, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse IAM policy for project %s: %v", projectID, err)
+	}
+	return &policy, nil
+}
+
+// MemberRoles returns the roles granted to member, marking conditional grants with their condition title
+func (p *IAMPolicy) MemberRoles(member string) []string {
+	var roles []string
+	for _, binding := range p.Bindings {
+		if !slices.Contains(binding.Members, member) {
+			continue
+		}
+		if binding.Condition != nil {
+			roles = append(roles, fmt.Sprintf("%s (if %s)", binding.Role, binding.Condition.Title))
+			continue
+		}
+		roles = append(roles, binding.Role)
+	}
+	return roles
+}
+
+// ListWorkloadIdentityBindings returns every workload identity member bound to a service account in the projects
+func ListWorkloadIdentityBindings(projectIDs ...string) ([]ServiceAccountBinding, error) {
+	return ListWorkloadIdentityBindingsContext(context.Background(), projectIDs...)
+}
+
+// ListWorkloadIdentityBindingsContext is ListWorkloadIdentityBindings with a context that kills gcloud when done
+func ListWorkloadIdentityBindingsContext(ctx context.Context, projectIDs ...string) ([]ServiceAccountBinding, error) {
+	var bindings []ServiceAccountBinding
+	for _, projectID := range projectIDs {
+		projectBindings, err := listProjectWorkloadIdentityBindings(ctx, projectID)
+		if err != nil {
+			return nil, err
+		}
+		bindings = append(bindings, projectBindings...)
+	}
+	return bindings, nil
+}
+
+func listProjectWorkloadIdentityBindings(ctx context.Context, projectID string) ([]ServiceAccountBinding, error) {
+	accounts, err := ListServiceAccountsContext(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	var bindings []ServiceAccountBinding
+	for _, account := range accounts {
+		if account == "" {
+			continue
+		}
+		policy, err := GetServiceAccountPolicyContext(ctx, projectID, account)
+		if err != nil {
+			return nil, err
+		}
+		for _, binding := range policy.Bindings {
+			for _, member := range binding.Members {
+				principal, ok := ParseWorkloadPrincipal(member)
+				if !ok {
+					continue
+				}
+				bindings = append(bindings, ServiceAccountBinding{
+					ServiceAccount: account,
+					Role:           binding.Role,
+					Member:         member,
+					Principal:      principal,
+					Condition:      binding.Condition,
+				})
+			}
+		}
+	}
+	return bindings, nil
+}
+
+// PoolBindings returns the service account bindings in the projects whose principal references the pool
+func PoolBindings(projectNumber, poolName string, projectIDs ...string) ([]ServiceAccountBinding, error) {
+	bindings, err := ListWorkloadIdentityBindings(projectIDs...)
+	if err != nil {
+		return nil, err
+	}
+
+	var poolBindings []ServiceAccountBinding
+	for _, binding := range bindings {
+		if binding.Principal.ProjectNumber == projectNumber && binding.Principal.Pool == poolName {
+			poolBindings = append(poolBindings, binding)
+		}
+	}
+	return poolBindings, nil
+}
+
+// RemoveServiceAccountBinding removes a single member from a role on a service account,
+// matching the binding condition exactly so other conditional bindings are left alone.
+// projectID is used when the project can't be taken from the service account email.
+func RemoveServiceAccountBinding(projectID string, binding ServiceAccountBinding) error {
+	args := []string{"iam", "service-accounts", "remove-iam-policy-binding",
+		binding.ServiceAccount,
+		"--project", serviceAccountEmailProject(binding.ServiceAccount, projectID),
+		"--role", binding.Role,
+		"--member", binding.Member,
+		"--format", "none"}
+
+	conditionArgs, cleanup, err := bindingConditionArgs(binding.Condition)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	return runGcloud("remove binding from "+binding.ServiceAccount, gcloudCommand(append(args, conditionArgs...)...))
+}
+
+// bindingConditionArgs returns the gcloud arguments matching an IAM condition exactly, or no condition when nil.
+// Call cleanup once the command has run.
+func bindingConditionArgs(condition *IAMCondition) (args []string, cleanup func(), err error) {
+	if condition == nil {
+		return []string{"--condition", "None"}, func() {}, nil
+	}
+
+	// Condition expressions may contain commas, which --condition can't express, so pass them as a file
+	file, err := os.CreateTemp("", "gwif-condition-*.json")
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup = func() { os.Remove(file.Name()) }
+	if err := json.NewEncoder(file).Encode(condition); err != nil {
+		file.Close()
+		cleanup()
+		return nil, nil, err
+	}
+	if err := file.Close(); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	return []string{"--condition-from-file", file.Name()}, cleanup, nil
+}
+
+// bindingProjects returns the projects whose service accounts are scanned for bindings:
+// the pool's project followed by the --service-account-project projects
+func bindingProjects(cfg *config) []string {
+	return uniqueProjects(cfg.projectID, cfg.serviceAccountProjects)
+}
+
+// uniqueProjects returns projectID followed by the other projects, without duplicates
+func uniqueProjects(projectID string, others []string) []string {
+	projects := []string{projectID}
+	for _, project := range others {
+		if !slices.Contains(projects, project) {
+			projects = append(projects, project)
+		}
+	}
+	return projects
+}
+
+// warnUnscannedProjects notes that bindings on service accounts outside the scanned projects are not covered
+func warnUnscannedProjects(cfg *config) {
+	if len(cfg.serviceAccountProjects) == 0 {
+		fmt.Fprintf(os.Stderr, "NOTE: Only service accounts in project %s are scanned for bindings - add --service-account-project for service accounts in other projects bound to its pools.\n", cfg.projectID)
+	}
+}
+
+// serviceAccountEmailProject returns the project of a user-managed service account from its email, or fallback
+func serviceAccountEmailProject(email, fallback string) string {
+	if _, domain, _ := strings.Cut(email, "@"); strings.HasSuffix(domain, ".iam.gserviceaccount.com") {
+		return strings.TrimSuffix(domain, ".iam.gserviceaccount.com")
+	}
+	return fallback
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common"
+	celast "github.com/google/cel-go/common/ast"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/ext"
+)
+
+// This file builds the CEL (https://github.com/google/cel-spec) expressions used by workload identity
+// attribute mappings and conditions, and checks and evaluates them with cel-go before gcloud sees them.
+
+// ========================= Builder =========================
+
+// celString quotes s as a CEL string literal, escaping quotes, backslashes and control characters
+func celString(s string) string {
+	var b strings.Builder
+	b.WriteByte('\'')
+	for _, r := range s {
+		switch r {
+		case '\\':
+			b.WriteString(`\\`)
+		case '\'':
+			b.WriteString(`\'`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\x%02x`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('\'')
+	return b.String()
+}
+
+// celClaimEquals builds assertion.<claim>=='<value>'
+func celClaimEquals(claim, value string) string {
+	return fmt.Sprintf("assertion.%s==%s", claim, celString(value))
+}
+
+// celAnd joins the non-empty clauses with &&
+func celAnd(clauses ...string) string {
+	var parts []string
+	for _, clause := range clauses {
+		if clause != "" {
+			parts = append(parts, clause)
+		}
+	}
+	return strings.Join(parts, " && ")
+}
+
+// ========================= GitHub claims =========================
+
+// githubClaims are the claims GitHub issues in Actions OIDC tokens
+// https://docs.github.com/en/actions/security-for-github-actions/security-hardening-your-deployments/about-security-hardening-with-openid-connect
+var githubClaims = []string{
+	"actor",
+	"actor_id",
+	"aud",
+	"base_ref",
+	"check_run_id",
+	"enterprise",
+	"enterprise_id",
+	"environment",
+	"environment_node_id",
+	"event_name",
+	"exp",
+	"head_ref",
+	"iat",
+	"iss",
+	"job_workflow_ref",
+	"job_workflow_sha",
+	"jti",
+	"nbf",
+	"ref",
+	"ref_protected",
+	"ref_type",
+	"repository",
+	"repository_id",
+	"repository_owner",
+	"repository_owner_id",
+	"repository_visibility",
+	"run_attempt",
+	"run_id",
+	"run_number",
+	"runner_environment",
+	"sha",
+	"sub",
+	"workflow",
+	"workflow_ref",
+	"workflow_sha",
+}
+
+// googleAttributes are the google attributes a condition can refer to
+var googleAttributes = []string{"display_name", "groups", "subject"}
+
+// ========================= Checking =========================
+
+// newCELEnv declares assertion, the token claims, and for conditions the mapped attribute and google
+// attributes. Like Google STS it adds the string extensions, e.g. split.
+func newCELEnv(condition bool) (*cel.Env, error) {
+	fields := cel.MapType(cel.StringType, cel.DynType)
+	opts := []cel.EnvOption{ext.Strings(), cel.Variable("assertion", fields)}
+	if condition {
+		opts = append(opts, cel.Variable("attribute", fields), cel.Variable("google", fields))
+	}
+	return cel.NewEnv(opts...)
+}
+
+// celFieldRef is a field an expression reads from one of the declared names, like assertion.ref
+type celFieldRef struct {
+	id    int64
+	root  string
+	field string
+}
+
+// celFieldRefs returns the fields an expression reads from assertion, attribute and google
+func celFieldRefs(ast *cel.Ast) []celFieldRef {
+	var refs []celFieldRef
+	for _, e := range celast.MatchDescendants(celast.NavigateAST(ast.NativeRep()), celast.KindMatcher(celast.SelectKind)) {
+		sel := e.AsSelect()
+		if sel.Operand().Kind() == celast.IdentKind {
+			refs = append(refs, celFieldRef{id: e.ID(), root: sel.Operand().AsIdent(), field: sel.FieldName()})
+		}
+	}
+	return refs
+}
+
+// compileCEL parses and type-checks an expression, then checks that it only reads claims GitHub
+// issues, google attributes STS sets and, when attributes are given, attributes the provider maps
+func compileCEL(expr string, condition bool, attributes []string) (*cel.Env, *cel.Ast, error) {
+	env, err := newCELEnv(condition)
+	if err != nil {
+		return nil, nil, err
+	}
+	ast, iss := env.Compile(expr)
+	if iss.Err() != nil {
+		return nil, nil, iss.Err()
+	}
+	iss = cel.NewIssuesWithSourceInfo(common.NewErrors(ast.Source()), ast.NativeRep().SourceInfo())
+	for _, ref := range celFieldRefs(ast) {
+		switch {
+		case ref.root == "assertion" && !slices.Contains(githubClaims, ref.field):
+			iss.ReportErrorAtID(ref.id, "GitHub tokens have no claim %q", ref.field)
+		case ref.root == "attribute" && len(attributes) > 0 && !slices.Contains(attributes, ref.field):
+			iss.ReportErrorAtID(ref.id, "the provider maps no attribute %q", ref.field)
+		case ref.root == "google" && !slices.Contains(googleAttributes, ref.field):
+			iss.ReportErrorAtID(ref.id, "unknown google attribute %q, expected subject, groups or display_name", ref.field)
+		}
+	}
+	if iss.Err() != nil {
+		return nil, nil, iss.Err()
+	}
+	return env, ast, nil
+}
+
+// CheckCondition parses and type-checks an attribute condition against the claims GitHub
+// issues and the attributes mapped by the provider
+func CheckCondition(condition string, mappedAttributes []string) error {
+	var attributes []string
+	for _, key := range mappedAttributes {
+		if name, ok := strings.CutPrefix(key, "attribute."); ok {
+			attributes = append(attributes, name)
+		}
+	}
+	_, ast, err := compileCEL(condition, true, attributes)
+	if err != nil {
+		return err
+	}
+	if t := ast.OutputType(); !t.IsExactType(cel.BoolType) && !t.IsExactType(cel.DynType) {
+		return fmt.Errorf("the condition must evaluate to true or false, but it evaluates to a %s", t)
+	}
+	return nil
+}
+
+// CheckMapping parses and type-checks an attribute mapping expression against the claims GitHub issues
+func CheckMapping(key, mapping string) error {
+	if _, _, err := compileCEL(mapping, false, nil); err != nil {
+		return fmt.Errorf("%s: %v", key, err)
+	}
+	return nil
+}
+
+// ========================= Evaluation =========================
+
+// celActivation holds the values expressions are evaluated against
+type celActivation struct {
+	assertion map[string]any
+	attribute map[string]any
+	google    map[string]any
+	// partial treats fields that aren't set as unknown rather than missing,
+	// for evaluating against the claims known ahead of a token
+	partial bool
+}
+
+// celUnknownError reports that a result depends on fields that are unknown in a partial evaluation
+type celUnknownError struct {
+	names []string
+}
+
+func (e *celUnknownError) Error() string {
+	return "depends on " + strings.Join(e.names, ", ")
+}
+
+// evalCEL checks and evaluates a mapping expression, or a condition when condition is set
+func evalCEL(expr string, condition bool, act *celActivation) (any, error) {
+	env, ast, err := compileCEL(expr, condition, nil)
+	if err != nil {
+		return nil, err
+	}
+	vars := map[string]any{"assertion": act.assertion, "attribute": act.attribute, "google": act.google}
+	for name, fields := range vars {
+		if fields.(map[string]any) == nil {
+			vars[name] = map[string]any{}
+		}
+	}
+
+	var unknowns []*cel.AttributePatternType
+	if act.partial {
+		for _, ref := range celFieldRefs(ast) {
+			fields, _ := vars[ref.root].(map[string]any)
+			if _, set := fields[ref.field]; !set {
+				unknowns = append(unknowns, cel.AttributePattern(ref.root).QualString(ref.field))
+			}
+		}
+	}
+	activation, err := cel.PartialVars(vars, unknowns...)
+	if err != nil {
+		return nil, err
+	}
+	program, err := env.Program(ast, cel.EvalOptions(cel.OptPartialEval))
+	if err != nil {
+		return nil, err
+	}
+	v, _, err := program.Eval(activation)
+	if err != nil {
+		return nil, err
+	}
+	if unknown, ok := v.(*types.Unknown); ok {
+		return nil, &celUnknownError{celUnknownNames(unknown)}
+	}
+	return v.Value(), nil
+}
+
+// celUnknownNames returns the fields an unknown result depends on, in the order the expression reads them
+func celUnknownNames(unknown *types.Unknown) []string {
+	var names []string
+	for _, id := range unknown.IDs() {
+		trails, _ := unknown.GetAttributeTrails(id)
+		for _, trail := range trails {
+			if name := trail.String(); !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// evalIAMCondition evaluates the IAM condition of a binding at now. Conditions reading more than
+// request.time, e.g. resource attributes, fail to compile.
+func evalIAMCondition(expression string, now time.Time) (bool, error) {
+	env, err := cel.NewEnv(cel.Variable("request", cel.MapType(cel.StringType, cel.DynType)))
+	if err != nil {
+		return false, err
+	}
+	ast, iss := env.Compile(expression)
+	if iss.Err() != nil {
+		return false, iss.Err()
+	}
+	program, err := env.Program(ast)
+	if err != nil {
+		return false, err
+	}
+	v, _, err := program.Eval(map[string]any{"request": map[string]any{"time": now}})
+	if err != nil {
+		return false, err
+	}
+	granted, ok := v.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("condition evaluated to %v, not true or false", v)
+	}
+	return granted, nil
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckCondition(t *testing.T) {
+	attributes := []string{"attribute.workflow", "attribute.repository"}
+	valid := []string{
+		`assertion.ref == r'x'`,
+		`assertion.repository_owner == 'acme' && assertion.repository in ['acme/a', 'acme/b']`,
+		`assertion.ref.startsWith('refs/tags/v')`,
+		`attribute.workflow == 'deploy'`,
+		`google.subject.endsWith(':ref:refs/heads/main')`,
+		`'admins' in google.groups`,
+		`has(assertion.environment) ? assertion.environment == 'prod' : false`,
+		`assertion.iat > 1700000000`,
+		`size(assertion.sub) < 200`,
+		`int(assertion.run_attempt) == 1`,
+		`uint(assertion.run_attempt) == 1u`,
+		`double(assertion.run_attempt) < 2.5`,
+		`assertion.event_name in {'push': true, 'workflow_dispatch': true}`,
+		`{'prod': 'main'}[assertion.environment] == 'main'`,
+	}
+	for _, condition := range valid {
+		if err := CheckCondition(condition, attributes); err != nil {
+			t.Errorf("CheckCondition(%q) failed: %v", condition, err)
+		}
+	}
+
+	invalid := []struct {
+		condition string
+		want      string
+	}{
+		{`'refs/' + assertion.ref`, "must evaluate to true or false"},
+		{`assertion.repositry == 'a/b'`, `GitHub tokens have no claim "repositry"`},
+		{`attribute.environment == 'prod'`, `the provider maps no attribute "environment"`},
+		{`google.email == 'x'`, "unknown google attribute"},
+		{`claims.ref == 'x'`, "undeclared reference to 'claims'"},
+		{`assertion.ref.startWith('refs/')`, "startWith"},
+		{`'refs' && true`, "expected type 'bool' but found 'string'"},
+		{`1.5 % 2.0 == 0.0`, "no matching overload"},
+		{`has(assertion)`, "invalid argument to has() macro"},
+		{`assertion.ref ==`, "Syntax error"},
+		{`assertion.ref == 'a' &&`, "Syntax error"},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.condition, func(t *testing.T) {
+			err := CheckCondition(tt.condition, attributes)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("CheckCondition(%q) error = %v, want %q", tt.condition, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckMapping(t *testing.T) {
+	for _, m := range providerAttributeMappings("123456789", "github-actions-pool", "github-provider") {
+		if err := CheckMapping(m.key, m.expression); err != nil {
+			t.Errorf("CheckMapping(%s) failed: %v", m.key, err)
+		}
+	}
+
+	invalid := []struct {
+		mapping string
+		want    string
+	}{
+		{`attribute.repository`, "undeclared reference to 'attribute'"},
+		{`google.subject`, "undeclared reference to 'google'"},
+		{`assertion.workflow_reff`, `GitHub tokens have no claim "workflow_reff"`},
+	}
+	for _, tt := range invalid {
+		err := CheckMapping("attribute.x", tt.mapping)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("CheckMapping(%q) error = %v, want %q", tt.mapping, err, tt.want)
+		}
+	}
+}
+
+// githubTestClaims are the claims of a push to main in acme/api running .github/workflows/deploy.yml
+func githubTestClaims() map[string]any {
+	return map[string]any{
+		"sub":                 "repo:acme/api:environment:prod",
+		"actor":               "octocat",
+		"repository":          "acme/api",
+		"repository_id":       "42",
+		"repository_owner":    "acme",
+		"repository_owner_id": "7",
+		"environment":         "prod",
+		"event_name":          "push",
+		"ref":                 "refs/heads/main",
+		"workflow_ref":        "acme/api/.github/workflows/deploy.yml@refs/heads/main",
+		"job_workflow_ref":    "acme/shared/.github/workflows/release.yml@refs/tags/v1",
+		"iat":                 int64(1700000000),
+	}
+}
+
+func TestProviderAttributeMappings(t *testing.T) {
+	mapping := map[string]string{}
+	for _, m := range providerAttributeMappings("123456789", "github-actions-pool", "github-provider") {
+		mapping[m.key] = m.expression
+	}
+
+	result := EvaluateMapping(mapping, githubTestClaims())
+	if len(result.Errors) > 0 {
+		t.Fatalf("EvaluateMapping failed: %v", result.Errors)
+	}
+	want := map[string]any{
+		"aud":                 "https://iam.googleapis.com/projects/123456789/locations/global/workloadIdentityPools/github-actions-pool/providers/github-provider",
+		"actor":               "octocat",
+		"repository":          "acme/api",
+		"repository_id":       "42",
+		"repository_owner_id": "7",
+		"environment":         "prod",
+		"workflow":            "deploy",
+		"job_workflow":        "acme/shared/.github/workflows/release.yml@refs/tags/v1",
+		"ref":                 "refs/heads/main",
+		"repo_workflow":       "acme/api/deploy",
+		"repo_env":            "acme/api/prod",
+		"repo_ref":            "acme/api/refs/heads/main",
+	}
+	if result.Subject != "repo:acme/api:environment:prod" {
+		t.Errorf("subject = %q", result.Subject)
+	}
+	if !reflect.DeepEqual(result.Attributes, want) {
+		t.Errorf("attributes = %v\nwant %v", result.Attributes, want)
+	}
+
+	// Jobs without an environment still map, with an empty repo_env
+	claims := githubTestClaims()
+	delete(claims, "environment")
+	result = EvaluateMapping(mapping, claims)
+	if v, ok := result.Attributes["repo_env"]; !ok || v != "" {
+		t.Errorf("repo_env without environment = %v, %v, want empty", v, result.Errors["attribute.repo_env"])
+	}
+}
+
+func TestConditionPresets(t *testing.T) {
+	attributes := []string{}
+	for _, m := range providerAttributeMappings("123456789", "github-actions-pool", "github-provider") {
+		attributes = append(attributes, m.key)
+	}
+
+	tests := []struct {
+		preset string
+		values []string
+		claims map[string]any
+		want   bool
+	}{
+		{"main-only", nil, map[string]any{"ref": "refs/heads/main"}, true},
+		{"main-only", nil, map[string]any{"ref": "refs/heads/dev"}, false},
+		{"release-tags", nil, map[string]any{"ref": "refs/tags/v1.2.3"}, true},
+		{"release-tags", nil, map[string]any{"ref": "refs/heads/v1"}, false},
+		{"no-pull-request", nil, map[string]any{"event_name": "push"}, true},
+		{"no-pull-request", nil, map[string]any{"event_name": "pull_request"}, false},
+		{"protected-environments", []string{"staging", "prod"}, map[string]any{"environment": "prod"}, true},
+		{"protected-environments", []string{"staging", "prod"}, map[string]any{"environment": "dev"}, false},
+		{"no-pull-request-target", nil, map[string]any{"event_name": "push"}, true},
+		{"no-pull-request-target", nil, map[string]any{"event_name": "pull_request_target"}, false},
+	}
+	tested := map[string]bool{}
+	for _, tt := range tests {
+		t.Run(tt.preset, func(t *testing.T) {
+			preset, ok := findConditionPreset(tt.preset)
+			if !ok {
+				t.Fatalf("no preset %s", tt.preset)
+			}
+			tested[tt.preset] = true
+			condition, err := selectedPreset{preset, tt.values}.Condition()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := CheckCondition(condition, attributes); err != nil {
+				t.Fatalf("CheckCondition(%q) failed: %v", condition, err)
+			}
+			got, err := EvaluateCondition(condition, tt.claims, MappingResult{})
+			if err != nil {
+				t.Fatalf("EvaluateCondition(%q) failed: %v", condition, err)
+			}
+			if got != tt.want {
+				t.Errorf("EvaluateCondition(%q) on %v = %v, want %v", condition, tt.claims, got, tt.want)
+			}
+		})
+	}
+	for _, preset := range conditionPresets {
+		if !tested[preset.name] {
+			t.Errorf("preset %s is not tested", preset.name)
+		}
+	}
+}
+
+func TestEvalCEL(t *testing.T) {
+	tests := []struct {
+		expr string
+		want any
+	}{
+		{`assertion.ref == r'refs/heads/main'`, true},
+		{`assertion.workflow_ref.split('.github/workflows/')[1].split('.')[0]`, "deploy"},
+		{`assertion.repository + '/' + assertion.environment`, "acme/api/prod"},
+		{`assertion.ref.matches(r'^refs/heads/(main|master)$')`, true},
+		{`assertion.environment in ['staging', 'prod']`, true},
+		{`has(assertion.base_ref)`, false},
+		{`has(assertion.base_ref) && assertion.base_ref == 'main'`, false},
+		{`assertion.iat > 1600000000 && assertion.iat < 0x7fffffff`, true},
+		{`uint(assertion.repository_id) == 42u`, true},
+		{`assertion.sub.startsWith('repo:acme/') || assertion.base_ref == 'x'`, true},
+		{`size(assertion.repository.lowerAscii())`, int64(8)},
+	}
+	act := &celActivation{assertion: githubTestClaims()}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := evalCEL(tt.expr, false, act)
+			if err != nil {
+				t.Fatalf("evalCEL(%q) failed: %v", tt.expr, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("evalCEL(%q) = %#v, want %#v", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvalCELErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{`assertion.base_ref == 'main'`, "no such key: base_ref"},
+		{`assertion.iat / 0`, "division by zero"},
+		{`assertion.ref.matches('(')`, "missing closing )"},
+		{`int(assertion.ref)`, "type conversion error"},
+		{`assertion.nbf == 0`, "no such key: nbf"},
+	}
+	act := &celActivation{assertion: githubTestClaims()}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := evalCEL(tt.expr, false, act)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("evalCEL(%q) error = %v, want %q", tt.expr, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvalCELPartial(t *testing.T) {
+	tests := []struct {
+		expr    string
+		want    any
+		unknown []string
+	}{
+		// A decisive side wins over an unknown one
+		{`assertion.repository == 'acme/api' && assertion.workflow == 'x'`, nil, []string{"assertion.workflow"}},
+		{`assertion.repository == 'other/api' && assertion.workflow == 'x'`, false, nil},
+		{`assertion.repository == 'acme/api' || assertion.workflow == 'x'`, true, nil},
+		{`assertion.workflow == 'x' || assertion.environment == 'y'`, nil, []string{"assertion.workflow", "assertion.environment"}},
+		{`has(assertion.environment)`, nil, []string{"assertion.environment"}},
+	}
+	act := &celActivation{assertion: map[string]any{"repository": "acme/api"}, partial: true}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := evalCEL(tt.expr, false, act)
+			var unknown *celUnknownError
+			if tt.unknown != nil {
+				if !errors.As(err, &unknown) {
+					t.Fatalf("evalCEL(%q) = %v, %v, want unknown", tt.expr, got, err)
+				}
+				if !reflect.DeepEqual(unknown.names, tt.unknown) {
+					t.Errorf("evalCEL(%q) unknowns = %v, want %v", tt.expr, unknown.names, tt.unknown)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("evalCEL(%q) = %v, %v, want %v", tt.expr, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCELString(t *testing.T) {
+	for _, s := range []string{"plain", "it's", `back\slash`, "tab\tnew\nline", "\x01ctrl", "ünïcode"} {
+		got, err := evalCEL(celString(s), false, &celActivation{})
+		if err != nil || got != s {
+			t.Errorf("celString(%q) round-trips to %q, %v", s, got, err)
+		}
+	}
+}
+
+func TestEvalIAMCondition(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		expression string
+		want       bool
+		wantErr    bool
+	}{
+		{expiryCondition(now.Add(time.Hour)).Expression, true, false},
+		{expiryCondition(now.Add(-time.Hour)).Expression, false, false},
+		{`request.time >= timestamp('2026-01-01T00:00:00Z') && request.time < timestamp('2026-02-01T00:00:00Z')`, false, false},
+		{`request.time.getHours('UTC') >= 9`, true, false},
+		{`resource.name.startsWith('projects/_/serviceAccounts/deploy')`, false, true},
+		{`request.time`, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			got, err := evalIAMCondition(tt.expression, now)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("evalIAMCondition(%q) = %v, %v, want %v, error %v", tt.expression, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// copyPlan is what gwif copy creates in the destination project
+type copyPlan struct {
+	source      *Setup
+	toProject   string
+	toNumber    string
+	poolExists  bool
+	providers   []copyProvider
+	newAccounts []string
+	bindings    []ServiceAccountBinding
+	skipped     []string
+}
+
+type copyProvider struct {
+	provider  Provider
+	mapping   string
+	condition string
+	exists    bool
+	// drift lists how an existing destination provider differs from the source
+	drift []string
+}
+
+// CopySetup copies a pool, its providers and the bindings referencing it to another project.
+// Service accounts are mapped by name, and project numbers in mappings and members are rewritten.
+func CopySetup(cfg *config) error {
+	fromNumber, err := getProjectNumber(cfg.fromProject)
+	if err != nil {
+		return err
+	}
+	toNumber, err := getProjectNumber(cfg.toProject)
+	if err != nil {
+		return err
+	}
+	source, err := LoadSetup(cfg.fromProject, fromNumber, cfg.poolName, cfg.serviceAccountProjects...)
+	if err != nil {
+		return err
+	}
+
+	plan, err := planCopy(source, cfg.toProject, toNumber, cfg.createServiceAccounts)
+	if err != nil {
+		return err
+	}
+	plan.print()
+
+	if plan.poolExists && !slices.ContainsFunc(plan.providers, func(p copyProvider) bool { return !p.exists }) && len(plan.bindings) == 0 {
+		fmt.Println("Nothing to copy.")
+		return nil
+	}
+	if !Ask(fmt.Sprintf("Apply this plan to project %s?", cfg.toProject)) {
+		return nil
+	}
+	return plan.apply()
+}
+
+func planCopy(source *Setup, toProject, toNumber string, createAccounts bool) (*copyPlan, error) {
+	plan := &copyPlan{source: source, toProject: toProject, toNumber: toNumber}
+
+	pools, err := ListPools(toProject, false)
+	if err != nil {
+		return nil, err
+	}
+	deletedPools, err := ListPools(toProject, true)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkDeletedNameCollision("pool", source.PoolID, pools, deletedPools); err != nil {
+		return nil, err
+	}
+	plan.poolExists = slices.Contains(pools, source.PoolID)
+
+	var existingProviders, deletedProviders []string
+	if plan.poolExists {
+		if existingProviders, err = ListProviders(toProject, source.PoolID, false); err != nil {
+			return nil, err
+		}
+		if deletedProviders, err = ListProviders(toProject, source.PoolID, true); err != nil {
+			return nil, err
+		}
+	}
+	for _, provider := range source.Providers {
+		if err := checkDeletedNameCollision("provider", provider.ID(), existingProviders, deletedProviders); err != nil {
+			return nil, err
+		}
+		mappings := make([]attributeMapping, 0, len(provider.AttributeMapping))
+		for _, key := range slices.Sorted(maps.Keys(provider.AttributeMapping)) {
+			mappings = append(mappings, attributeMapping{key, plan.rewrite(provider.AttributeMapping[key])})
+		}
+		copied := copyProvider{
+			provider:  provider,
+			mapping:   formatAttributeMapping(mappings),
+			condition: plan.rewrite(provider.AttributeCondition),
+			exists:    slices.Contains(existingProviders, provider.ID()),
+		}
+		if copied.exists {
+			existing, err := GetProvider(toProject, source.PoolID, provider.ID())
+			if err != nil {
+				return nil, err
+			}
+			copied.drift = plan.providerDrift(provider, *existing)
+		}
+		plan.providers = append(plan.providers, copied)
+	}
+
+	accounts, err := ListServiceAccounts(toProject)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for _, binding := range source.Bindings {
+		if expires, ok := bindingExpiry(binding); ok && !expires.After(now) {
+			plan.skipped = append(plan.skipped, fmt.Sprintf("%s: %s (%s)", binding.ServiceAccount, binding.Principal, formatValidity(expires, now)))
+			continue
+		}
+		account, ok := plan.mapServiceAccount(binding.ServiceAccount)
+		if !ok {
+			plan.skipped = append(plan.skipped, fmt.Sprintf("%s: %s (not a user-managed service account of project %s)", binding.ServiceAccount, binding.Principal, source.ProjectID))
+			continue
+		}
+		if !slices.Contains(accounts, account) && !slices.Contains(plan.newAccounts, account) {
+			if !createAccounts {
+				plan.skipped = append(plan.skipped, fmt.Sprintf("%s: %s (service account does not exist, use --create-service-accounts)", account, binding.Principal))
+				continue
+			}
+			plan.newAccounts = append(plan.newAccounts, account)
+		}
+
+		copied := binding
+		copied.ServiceAccount = account
+		copied.Member = plan.rewrite(binding.Member)
+		copied.Principal.ProjectNumber = toNumber
+		plan.bindings = append(plan.bindings, copied)
+	}
+	return plan, nil
+}
+
+// rewrite replaces references to the source project number, like the audience in the attribute
+// mapping and the pool in principalSet members, with the destination project number
+func (p *copyPlan) rewrite(s string) string {
+	return strings.ReplaceAll(s, "projects/"+p.source.ProjectNumber+"/", "projects/"+p.toNumber+"/")
+}
+
+// providerDrift lists the differences of an existing destination provider from the source provider
+func (p *copyPlan) providerDrift(source, existing Provider) []string {
+	var drift []string
+	if condition := p.rewrite(source.AttributeCondition); condition != existing.AttributeCondition {
+		drift = append(drift, fmt.Sprintf("condition is %s, source has %s", existing.AttributeCondition, condition))
+	}
+	for _, key := range unionKeys(source.AttributeMapping, existing.AttributeMapping) {
+		if mapping := p.rewrite(source.AttributeMapping[key]); mapping != existing.AttributeMapping[key] {
+			drift = append(drift, fmt.Sprintf("mapping %s is %q, source has %q", key, existing.AttributeMapping[key], mapping))
+		}
+	}
+	return drift
+}
+
+// mapServiceAccount maps a service account of the source project to the one with the same name in the destination
+func (p *copyPlan) mapServiceAccount(email string) (string, bool) {
+	name, found := strings.CutSuffix(email, "@"+p.source.ProjectID+".iam.gserviceaccount.com")
+	if !found {
+		return "", false
+	}
+	return name + "@" + p.toProject + ".iam.gserviceaccount.com", true
+}
+
+func (p *copyPlan) print() {
+	fmt.Printf("Copying pool %s from project %s to %s:\n", p.source.PoolID, p.source.ProjectID, p.toProject)
+	fmt.Println()
+
+	if p.poolExists {
+		fmt.Printf("Pool %s already exists... skipping\n", p.source.PoolID)
+	} else {
+		fmt.Printf("+ pool %s\n", p.source.PoolID)
+	}
+	for _, provider := range p.providers {
+		if provider.exists {
+			fmt.Printf("  provider %s already exists... skipping\n", provider.provider.ID())
+			for _, drift := range provider.drift {
+				fmt.Printf("    WARNING: %s\n", drift)
+			}
+			continue
+		}
+		fmt.Printf("+ provider %s\n", provider.provider.ID())
+		fmt.Printf("    condition: %s\n", provider.condition)
+		fmt.Printf("    mapping:   %s\n", provider.mapping)
+	}
+	for _, account := range p.newAccounts {
+		fmt.Printf("+ service account %s\n", account)
+	}
+	for _, binding := range p.bindings {
+		fmt.Printf("+ binding %s on %s\n", binding.Principal, binding.ServiceAccount)
+	}
+	fmt.Println()
+	if len(p.skipped) > 0 {
+		printImpact("Bindings not copied", p.skipped)
+	}
+}
+
+func (p *copyPlan) apply() error {
+	if !p.poolExists {
+		if err := runGcloud("create pool", gcloudCommand(recreatePoolArgs(p.toProject, p.source.PoolID, p.source.Pool)...)); err != nil {
+			return err
+		}
+	}
+
+	for _, provider := range p.providers {
+		if provider.exists {
+			continue
+		}
+		args := createProviderArgs(p.toProject, p.source.PoolID, provider.provider.ID(), provider.provider.DisplayName,
+			provider.mapping, provider.condition, provider.provider.Oidc.IssuerURI)
+		if len(provider.provider.Oidc.AllowedAudiences) > 0 {
+			audiences := make([]string, len(provider.provider.Oidc.AllowedAudiences))
+			for i, audience := range provider.provider.Oidc.AllowedAudiences {
+				audiences[i] = p.rewrite(audience)
+			}
+			args = append(args, "--allowed-audiences", strings.Join(audiences, ","))
+		}
+		if provider.provider.Disabled {
+			args = append(args, "--disabled")
+		}
+		if err := runGcloud("create provider", gcloudCommand(args...)); err != nil {
+			return err
+		}
+	}
+
+	for _, account := range p.newAccounts {
+		name, _, _ := strings.Cut(account, "@")
+		cmd := gcloudCommand("iam", "service-accounts", "create", name, "--project", p.toProject)
+		if err := runGcloud("create service account "+account, cmd); err != nil {
+			return err
+		}
+	}
+
+	for _, binding := range p.bindings {
+		if err := p.addBinding(binding); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Copied pool %s to project %s.\n", p.source.PoolID, p.toProject)
+	return nil
+}
+
+// copyBindingAttempts bounds the retries of a binding on a service account that isn't visible to IAM yet
+const copyBindingAttempts = 5
+
+// addBinding adds a binding in the destination, retrying while a service account created just before is
+// still propagating through IAM and reported as not found
+func (p *copyPlan) addBinding(binding ServiceAccountBinding) error {
+	conditionArgs, cleanup, err := bindingConditionArgs(binding.Condition)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	args := append(addBindingArgs(p.toProject, binding.ServiceAccount, binding.Role, binding.Member), "--format", "none")
+	args = append(args, conditionArgs...)
+	for attempt := 1; ; attempt++ {
+		err := runGcloud("add service account binding", gcloudCommand(args...))
+		if err == nil || !errors.Is(err, ErrNotFound) || attempt == copyBindingAttempts {
+			return err
+		}
+		delay := time.Duration(attempt) * 5 * time.Second
+		fmt.Printf("Service account %s not found yet, retrying in %s...\n", binding.ServiceAccount, delay)
+		time.Sleep(delay)
+	}
+}
@@ -2,19 +2,18 @@ package main
 
 import (
 	"fmt"
-	"os"
-	"os/exec"
+	"strings"
 )
 
 func CreatePool(cfg *config) error {
-	// Check if pool exists
-	cmd := exec.Command("gcloud", "iam", "workload-identity-pools", "describe",
-		cfg.poolName,
-		"--project", cfg.projectID,
-		"--location", "global",
-		"--format", "value(name)")
-
-	if err := cmd.Run(); err == nil {
+	// Check if pool exists, a deleted pool keeps its name for 30 days
+	if pool, err := GetPool(cfg.projectID, cfg.poolName); err == nil {
+		if pool.State == "DELETED" {
+			return &GcloudError{Op: "create pool", Kind: ErrDeletedNameInUse,
+				Message: fmt.Sprintf("pool name %s is held by a deleted pool", cfg.poolName),
+				Guidance: fmt.Sprintf("restore it with gcloud iam workload-identity-pools undelete %s --project %s --location global, or choose another name",
+					cfg.poolName, cfg.projectID)}
+		}
 		fmt.Printf("Pool %s already exists... skipping\n", cfg.poolName)
 		return nil
 	}
@@ -23,30 +22,19 @@ func CreatePool(cfg *config) error {
 		return fmt.Errorf("cannot continue without a pool")
 	}
 
-	cmd = exec.Command("gcloud", "iam", "workload-identity-pools", "create",
-		cfg.poolName,
-		"--project", cfg.projectID,
-		"--location", "global",
-		"--display-name", cfg.poolName)
-
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to create pool: %v", err)
-	}
-
-	return nil
+	cmd := gcloudCommand(createPoolArgs(cfg.projectID, cfg.poolName, cfg.poolName)...)
+	return runGcloud("create pool", cmd)
 }
 
 func CreateProvider(cfg *config, projectNumber, githubRepositoryFullName string) error {
-	// Check if provider exists
-	cmd := exec.Command("gcloud", "iam", "workload-identity-pools", "providers", "describe",
-		cfg.providerName,
-		"--project", cfg.projectID,
-		"--location", "global",
-		"--workload-identity-pool", cfg.poolName,
-		"--format", "value(name)")
-
-	if err := cmd.Run(); err == nil {
+	// Check if provider exists, a deleted provider keeps its name for 30 days
+	if provider, err := GetProvider(cfg.projectID, cfg.poolName, cfg.providerName); err == nil {
+		if provider.State == "DELETED" {
+			return &GcloudError{Op: "create provider", Kind: ErrDeletedNameInUse,
+				Message: fmt.Sprintf("provider name %s is held by a deleted provider", cfg.providerName),
+				Guidance: fmt.Sprintf("run gwif providers restore --pool %s --provider %s, or choose another name",
+					cfg.poolName, cfg.providerName)}
+		}
 		fmt.Printf("Provider %s already exists... skipping\n", cfg.providerName)
 		return nil
 	}
@@ -61,7 +49,8 @@ func CreateProvider(cfg *config, projectNumber, githubRepositoryFullName string)
 |                        associate service account by workflow                          |
 |---------------------------------------------------------------------------------------|
 
-NOTE: Only one attribute can be used for service account assignment
+NOTE: Only one attribute can be used for service account assignment - use the composite
+      repo_workflow, repo_env or repo_ref attributes to bind on the repository plus another claim
 
 RECOMMENDATION: 
 - Be as specific as possible with conditions to improve security e.g. If your CI only runs on main,
@@ -72,66 +61,191 @@ RECOMMENDATION:
 
 `)
 
-	audience := fmt.Sprintf("'https://iam.googleapis.com/projects/%s/locations/global/workloadIdentityPools/%s/providers/%s'",
-		projectNumber, cfg.poolName, cfg.providerName)
-
-	attributeMapping := fmt.Sprintf("google.subject=assertion.sub,"+
-		"attribute.aud=%s,"+
-		"attribute.actor=assertion.actor,"+
-		"attribute.repository=assertion.repository,"+
-		"attribute.environment=assertion.environment,"+
-		"attribute.workflow=assertion.workflow_ref.split('.github/workflows/')[1].split('.')[0].split('@')[0],"+
-		"attribute.ref=assertion.ref",
-		audience)
+	mappings := providerAttributeMappings(projectNumber, cfg.poolName, cfg.providerName)
 
-	attributeCondition := fmt.Sprintf("assertion.repository_owner=='%s'", cfg.githubRepositoryOwner)
+	attributeCondition, repositoryCondition := repositoryConditions(cfg.githubRepositoryOwner, cfg.githubRepositoryOwnerID, githubRepositoryFullName, cfg.githubRepositoryID)
 
-	if cfg.unsafe {
+	if cfg.orgProvider {
+		fmt.Printf("NOTE: Org provider - every repository of %s is admitted, gwif auth only binds service accounts by repository.\n", cfg.githubRepositoryOwner)
+		fmt.Println()
+	} else if cfg.unsafe {
 		if Ask("Apply repository condition to the provider?") {
-			attributeCondition = fmt.Sprintf("%s && assertion.repository=='%s'", attributeCondition, githubRepositoryFullName)
+			attributeCondition = celAnd(attributeCondition, repositoryCondition)
 		} else {
-			fmt.Println("WARNING: Not applying repository condition to the provider - MUST use repository full name to associate the service account e.g. owner/repo")
+			fmt.Println("WARNING: Not applying repository condition to the provider - MUST use repository_id or repository full name to associate the service account e.g. owner/repo")
 			if !RequiredAsk("Have you read the warning?", "It is critical to use the repository for service account association if not using repository condition") {
 				return fmt.Errorf("user declined to acknowledge warning")
 			}
 		}
 	} else {
-		attributeCondition = fmt.Sprintf("%s && assertion.repository=='%s'", attributeCondition, githubRepositoryFullName)
+		attributeCondition = celAnd(attributeCondition, repositoryCondition)
+	}
+
+	presets, err := SelectConditionPresets(cfg.conditionPresets)
+	if err != nil {
+		return err
+	}
+	for _, preset := range presets {
+		condition, err := preset.Condition()
+		if err != nil {
+			return err
+		}
+		attributeCondition = celAnd(attributeCondition, condition)
 	}
 
 	if Ask("[NOT RECOMMENDED] Apply workflow condition to the provider?") {
 		workflow := GetInput("Enter your workflow name:")
-		attributeCondition = fmt.Sprintf("%s && assertion.workflow=='%s'", attributeCondition, workflow)
+		attributeCondition = celAnd(attributeCondition, celClaimEquals("workflow", workflow))
 	}
 
 	if Ask("[PROBABLY NOT NEEDED] Apply environment condition to the provider?") {
 		env := GetInput("Enter your environment name:")
-		attributeCondition = fmt.Sprintf("%s && assertion.environment=='%s'", attributeCondition, env)
+		attributeCondition = celAnd(attributeCondition, celClaimEquals("environment", env))
 	}
 
 	if Ask("[PROBABLY NOT NEEDED] Apply branch condition to the provider?") {
 		branch := GetInput("Enter your branch name:")
-		attributeCondition = fmt.Sprintf("%s && assertion.ref=='refs/heads/%s'", attributeCondition, branch)
+		attributeCondition = celAnd(attributeCondition, celClaimEquals("ref", "refs/heads/"+branch))
+	}
+
+	fmt.Println()
+	fmt.Println("Attribute condition:")
+	fmt.Printf("  %s\n", attributeCondition)
+	fmt.Println()
+
+	if err := validateProviderExpressions(mappings, attributeCondition); err != nil {
+		return err
 	}
 
 	if !Ask("Create provider (" + cfg.providerName + ")?") {
 		return fmt.Errorf("cannot continue without a provider")
 	}
 
-	cmd = exec.Command("gcloud", "iam", "workload-identity-pools", "providers", "create-oidc",
-		cfg.providerName,
-		"--project", cfg.projectID,
+	return createProvider(cfg.projectID, cfg.poolName, cfg.providerName, mappings, attributeCondition)
+}
+
+// repositoryConditions returns the owner and repository clauses of a provider condition,
+// pinned by numeric ID when known as names can be reclaimed after a rename
+func repositoryConditions(owner, ownerID, repositoryFullName, repositoryID string) (ownerCondition, repositoryCondition string) {
+	ownerCondition = celClaimEquals("repository_owner", owner)
+	if ownerID != "" {
+		ownerCondition = celClaimEquals("repository_owner_id", ownerID)
+	}
+	repositoryCondition = celClaimEquals("repository", repositoryFullName)
+	if repositoryID != "" {
+		repositoryCondition = celClaimEquals("repository_id", repositoryID)
+	}
+	return ownerCondition, repositoryCondition
+}
+
+// createProvider creates a GitHub OIDC provider with the given mapping and condition
+func createProvider(projectID, poolName, providerName string, mappings []attributeMapping, condition string) error {
+	cmd := gcloudCommand(createProviderArgs(projectID, poolName, providerName, providerName,
+		formatAttributeMapping(mappings), condition, githubIssuer)...)
+
+	return runGcloud("create provider", cmd)
+}
+
+const githubIssuer = "https://token.actions.githubusercontent.com"
+
+// createPoolArgs returns the gcloud arguments creating a pool
+func createPoolArgs(projectID, poolName, displayName string) []string {
+	return []string{"iam", "workload-identity-pools", "create",
+		poolName,
+		"--project", projectID,
+		"--location", "global",
+		"--display-name", displayName}
+}
+
+// recreatePoolArgs returns the gcloud arguments creating a pool like an existing one, with its description and disabled state
+func recreatePoolArgs(projectID, poolName string, pool Pool) []string {
+	args := createPoolArgs(projectID, poolName, pool.DisplayName)
+	if pool.Description != "" {
+		args = append(args, "--description", pool.Description)
+	}
+	if pool.Disabled {
+		args = append(args, "--disabled")
+	}
+	return args
+}
+
+// createProviderArgs returns the gcloud arguments creating an OIDC provider
+func createProviderArgs(projectID, poolName, providerName, displayName, mapping, condition, issuer string) []string {
+	return []string{"iam", "workload-identity-pools", "providers", "create-oidc",
+		providerName,
+		"--project", projectID,
 		"--location", "global",
-		"--workload-identity-pool", cfg.poolName,
-		"--display-name", cfg.providerName,
-		"--attribute-mapping", attributeMapping,
-		"--attribute-condition", attributeCondition,
-		"--issuer-uri", "https://token.actions.githubusercontent.com")
+		"--workload-identity-pool", poolName,
+		"--display-name", displayName,
+		"--attribute-mapping", mapping,
+		"--attribute-condition", condition,
+		"--issuer-uri", issuer}
+}
 
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to create provider: %v", err)
+// attributeMapping maps a provider attribute to a CEL expression over the GitHub token claims
+type attributeMapping struct {
+	key        string
+	expression string
+}
+
+// providerAttributeMappings returns the attribute mapping gwif configures on providers
+func providerAttributeMappings(projectNumber, poolName, providerName string) []attributeMapping {
+	audience := fmt.Sprintf("https://iam.googleapis.com/projects/%s/locations/global/workloadIdentityPools/%s/providers/%s",
+		projectNumber, poolName, providerName)
+
+	return []attributeMapping{
+		{"google.subject", "assertion.sub"},
+		{"attribute.aud", celString(audience)},
+		{"attribute.actor", "assertion.actor"},
+		{"attribute.repository", "assertion.repository"},
+		{"attribute.repository_id", "assertion.repository_id"},
+		{"attribute.repository_owner_id", "assertion.repository_owner_id"},
+		{"attribute.environment", "assertion.environment"},
+		{"attribute.workflow", workflowExpression},
+		{"attribute.job_workflow", "assertion.job_workflow_ref"},
+		{"attribute.ref", "assertion.ref"},
+		// Composite attributes bind a service account to one repository and workflow, environment or ref,
+		// which keeps bindings precise on org providers
+		{"attribute.repo_workflow", "assertion.repository + '/' + " + workflowExpression},
+		{"attribute.repo_env", "has(assertion.environment) ? assertion.repository + '/' + assertion.environment : ''"},
+		{"attribute.repo_ref", "assertion.repository + '/' + assertion.ref"},
+	}
+}
+
+// workflowExpression extracts the workflow file name without extension from the workflow_ref claim
+const workflowExpression = "assertion.workflow_ref.split('.github/workflows/')[1].split('.')[0].split('@')[0]"
+
+// formatAttributeMapping renders mappings in the key=expression,... form gcloud expects. When an
+// expression contains a comma, gcloud's ^delimiter^ syntax separates the mappings with another character.
+func formatAttributeMapping(mappings []attributeMapping) string {
+	parts := make([]string, len(mappings))
+	for i, m := range mappings {
+		parts[i] = m.key + "=" + m.expression
+	}
+	joined := strings.Join(parts, "")
+	if !strings.Contains(joined, ",") {
+		return strings.Join(parts, ",")
 	}
+	for _, delimiter := range []string{";", "|", "#", "~", "!", "%"} {
+		if !strings.Contains(joined, delimiter) {
+			return "^" + delimiter + "^" + strings.Join(parts, delimiter)
+		}
+	}
+	// Every candidate appears in the expressions, a multi-character delimiter can't
+	return "^;;;^" + strings.Join(parts, ";;;")
+}
 
+// validateProviderExpressions parses and type-checks the mapping and condition before gcloud sees them
+func validateProviderExpressions(mappings []attributeMapping, condition string) error {
+	keys := make([]string, len(mappings))
+	for i, m := range mappings {
+		if err := CheckMapping(m.key, m.expression); err != nil {
+			return fmt.Errorf("invalid attribute mapping %v", err)
+		}
+		keys[i] = m.key
+	}
+	if err := CheckCondition(condition, keys); err != nil {
+		return fmt.Errorf("invalid attribute condition: %v", err)
+	}
 	return nil
 }
@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func TestFormatAttributeMapping(t *testing.T) {
+	tests := []struct {
+		name     string
+		mappings []attributeMapping
+		want     string
+	}{
+		{
+			name:     "plain",
+			mappings: []attributeMapping{{"google.subject", "assertion.sub"}, {"attribute.ref", "assertion.ref"}},
+			want:     "google.subject=assertion.sub,attribute.ref=assertion.ref",
+		},
+		{
+			name:     "comma in an expression",
+			mappings: []attributeMapping{{"google.subject", "assertion.sub.split(',')[0]"}, {"attribute.ref", "assertion.ref"}},
+			want:     "^;^google.subject=assertion.sub.split(',')[0];attribute.ref=assertion.ref",
+		},
+		{
+			name:     "comma and semicolon",
+			mappings: []attributeMapping{{"google.subject", "assertion.sub.split(',')[0]"}, {"attribute.x", "assertion.x.split(';')[0]"}},
+			want:     "^|^google.subject=assertion.sub.split(',')[0]|attribute.x=assertion.x.split(';')[0]",
+		},
+		{
+			name:     "every single-character delimiter taken",
+			mappings: []attributeMapping{{"google.subject", "',;|#~!%'"}},
+			want:     "^;;;^google.subject=',;|#~!%'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatAttributeMapping(tt.mappings); got != tt.want {
+				t.Errorf("formatAttributeMapping() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,51 +2,143 @@ package main
 
 import (
 	"fmt"
-	"os"
-	"os/exec"
+	"strings"
 )
 
-func DeletePool(cfg *config) error {
-	if Ask(fmt.Sprintf("Are you sure you want to delete the pool [%s > %s]?", cfg.projectID, cfg.poolName)) {
-		cmd := exec.Command("gcloud", "iam", "workload-identity-pools", "delete", cfg.poolName, "--project", cfg.projectID, "--location", "global", "--quiet")
-		cmd.Stderr = os.Stderr
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("failed to delete pool: %v", err)
+func DeletePool(cfg *config, projectNumber string) error {
+	providers, err := ListProviders(cfg.projectID, cfg.poolName, false)
+	if err != nil {
+		return err
+	}
+	bindings, err := PoolBindings(projectNumber, cfg.poolName, bindingProjects(cfg)...)
+	if err != nil {
+		return err
+	}
+	warnUnscannedProjects(cfg)
+
+	fmt.Printf("Deleting pool [%s > %s] affects:\n", cfg.projectID, cfg.poolName)
+	fmt.Println()
+	printImpact("Providers that stop accepting tokens", providers)
+	printImpact("Service account bindings that become unreachable", formatBindings(bindings))
+
+	// Deleting a pool with active providers cuts off every workflow using it, so make it deliberate
+	if len(providers) > 0 {
+		confirmation := GetInput(fmt.Sprintf("The pool has %d active provider(s). Type the pool name (%s) to confirm deletion:", len(providers), cfg.poolName))
+		if confirmation != cfg.poolName {
+			fmt.Println("Pool name did not match - not deleting.")
+			return nil
 		}
-		fmt.Println("Pool deleted successfully - it will be removed after a 30 day grace period and can be restored until then.")
+	} else if !Ask(fmt.Sprintf("Are you sure you want to delete the pool [%s > %s]?", cfg.projectID, cfg.poolName)) {
+		return nil
 	}
-	return nil
+
+	cmd := gcloudCommand("iam", "workload-identity-pools", "delete", cfg.poolName, "--project", cfg.projectID, "--location", "global", "--quiet")
+	if err := runGcloud("delete pool", cmd); err != nil {
+		return err
+	}
+	fmt.Println("Pool deleted successfully - it will be removed after a 30 day grace period and can be restored until then.")
+
+	return OfferBindingRemoval(cfg.projectID, bindings)
 }
 
-func DeleteProvider(cfg *config) error {
-	if Ask(fmt.Sprintf("Are you sure you want to delete the provider [%s > %s > %s]?", cfg.projectID, cfg.poolName, cfg.providerName)) {
-		cmd := exec.Command("gcloud", "iam", "workload-identity-pools", "providers", "delete",
-			cfg.providerName,
-			"--project", cfg.projectID,
-			"--location", "global",
-			"--quiet",
-			"--workload-identity-pool", cfg.poolName)
-
-		cmd.Stderr = os.Stderr
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("failed to delete provider: %v", err)
+func DeleteProvider(cfg *config, projectNumber string) error {
+	providers, err := ListProviders(cfg.projectID, cfg.poolName, false)
+	if err != nil {
+		return err
+	}
+	var remaining []string
+	for _, provider := range providers {
+		if provider != cfg.providerName {
+			remaining = append(remaining, provider)
 		}
+	}
+	bindings, err := PoolBindings(projectNumber, cfg.poolName, bindingProjects(cfg)...)
+	if err != nil {
+		return err
+	}
+	warnUnscannedProjects(cfg)
+
+	// Bindings reference the pool, not the provider, so they only become unreachable with the last provider
+	fmt.Printf("Deleting provider [%s > %s > %s] affects:\n", cfg.projectID, cfg.poolName, cfg.providerName)
+	fmt.Println()
+	if len(remaining) > 0 {
+		printImpact("Service account bindings in the pool (still reachable through the remaining providers)", formatBindings(bindings))
+		printImpact("Remaining providers in the pool", remaining)
+	} else {
+		printImpact("Service account bindings that become unreachable (this is the last provider in the pool)", formatBindings(bindings))
+	}
+
+	if !Ask(fmt.Sprintf("Are you sure you want to delete the provider [%s > %s > %s]?", cfg.projectID, cfg.poolName, cfg.providerName)) {
+		return nil
+	}
+
+	cmd := gcloudCommand("iam", "workload-identity-pools", "providers", "delete",
+		cfg.providerName,
+		"--project", cfg.projectID,
+		"--location", "global",
+		"--quiet",
+		"--workload-identity-pool", cfg.poolName)
 
-		fmt.Println("Provider deleted successfully - it will be removed after a 30 day grace period and can be restored until then.")
+	if err := runGcloud("delete provider", cmd); err != nil {
+		return err
+	}
+
+	fmt.Println("Provider deleted successfully - it will be removed after a 30 day grace period and can be restored until then.")
+
+	if len(remaining) == 0 {
+		return OfferBindingRemoval(cfg.projectID, bindings)
 	}
 	return nil
 }
 
 func RestoreProvider(cfg *config) error {
-	cmd := exec.Command("gcloud", "iam", "workload-identity-pools", "providers", "undelete",
+	cmd := gcloudCommand("iam", "workload-identity-pools", "providers", "undelete",
 		cfg.providerName,
 		"--project", cfg.projectID,
 		"--location", "global",
 		"--workload-identity-pool", cfg.poolName)
 
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to restore provider: %v", err)
+	if err := runGcloud("restore provider", cmd); err != nil {
+		return err
 	}
 	return nil
 }
+
+// OfferBindingRemoval asks to remove service account bindings left pointing at a deleted pool
+func OfferBindingRemoval(projectID string, bindings []ServiceAccountBinding) error {
+	if len(bindings) == 0 {
+		return nil
+	}
+	fmt.Println()
+	if !Ask(fmt.Sprintf("Also remove the %d service account binding(s) referencing the pool?", len(bindings))) {
+		fmt.Println("Bindings kept - they become active again if the pool is restored.")
+		return nil
+	}
+
+	for _, binding := range bindings {
+		if err := RemoveServiceAccountBinding(projectID, binding); err != nil {
+			return err
+		}
+		fmt.Printf("Removed %s from %s\n", binding.Principal, binding.ServiceAccount)
+	}
+	return nil
+}
+
+func printImpact(title string, items []string) {
+	fmt.Printf("%s (%d):\n", title, len(items))
+	if len(items) == 0 {
+		fmt.Println("  none")
+	}
+	for _, item := range items {
+		fmt.Printf("  - %s\n", item)
+	}
+	fmt.Println()
+}
+
+func formatBindings(bindings []ServiceAccountBinding) []string {
+	lines := make([]string, len(bindings))
+	for i, binding := range bindings {
+		lines[i] = fmt.Sprintf("%s: %s (%s)", binding.ServiceAccount, binding.Principal, strings.TrimPrefix(binding.Role, "roles/"))
+	}
+	return lines
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Provider is a workload identity pool provider as returned by gcloud
+type Provider struct {
+	Name               string            `json:"name"`
+	DisplayName        string            `json:"displayName"`
+	State              string            `json:"state"`
+	Disabled           bool              `json:"disabled"`
+	AttributeMapping   map[string]string `json:"attributeMapping"`
+	AttributeCondition string            `json:"attributeCondition"`
+	Oidc               struct {
+		IssuerURI        string   `json:"issuerUri"`
+		AllowedAudiences []string `json:"allowedAudiences"`
+	} `json:"oidc"`
+}
+
+// Pool is a workload identity pool as returned by gcloud
+type Pool struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+	Description string `json:"description"`
+	State       string `json:"state"`
+	Disabled    bool   `json:"disabled"`
+}
+
+// GetPool returns the configuration of a workload identity pool
+func GetPool(projectID, poolName string) (*Pool, error) {
+	cmd := gcloudCommand("iam", "workload-identity-pools", "describe",
+		poolName,
+		"--project", projectID,
+		"--location", "global",
+		"--format", "json")
+	output, err := outputGcloud("describe pool", cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	var pool Pool
+	if err := json.Unmarshal(output, &pool); err != nil {
+		return nil, fmt.Errorf("failed to parse pool: %v", err)
+	}
+	return &pool, nil
+}
+
+// GetProvider returns the full configuration of a workload identity provider
+func GetProvider(projectID, poolName, providerName string) (*Provider, error) {
+	cmd := gcloudCommand("iam", "workload-identity-pools", "providers", "describe",
+		providerName,
+		"--project", projectID,
+		"--location", "global",
+		"--workload-identity-pool", poolName,
+		"--format", "json")
+	output, err := outputGcloud("describe provider", cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	var provider Provider
+	if err := json.Unmarshal(output, &provider); err != nil {
+		return nil, fmt.Errorf("failed to parse provider: %v", err)
+	}
+	return &provider, nil
+}
+
+func DescribeProvider(cfg *config) error {
+	provider, err := GetProvider(cfg.projectID, cfg.poolName, cfg.providerName)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Name:         %s\n", provider.Name)
+	fmt.Printf("Display name: %s\n", provider.DisplayName)
+	fmt.Printf("State:        %s\n", provider.State)
+	if provider.Disabled {
+		fmt.Println("Disabled:     true")
+	}
+	fmt.Printf("Issuer:       %s\n", provider.Oidc.IssuerURI)
+
+	// Show the names behind pinned IDs, the condition itself only holds the numbers
+	client := NewGitHubClient()
+	for _, pin := range conditionPins(provider.AttributeCondition) {
+		switch pin.claim {
+		case "repository_owner_id":
+			name, err := client.OwnerName(pin.value)
+			if err != nil {
+				name = "unknown"
+			}
+			fmt.Printf("Owner:        %s (id %s)\n", name, pin.value)
+		case "repository_id":
+			name, err := client.RepositoryName(pin.value)
+			if err != nil {
+				name = "unknown"
+			}
+			fmt.Printf("Repository:   %s (id %s)\n", name, pin.value)
+		}
+	}
+
+	fmt.Println()
+	fmt.Println("Attribute condition:")
+	fmt.Printf("  %s\n", provider.AttributeCondition)
+
+	fmt.Println()
+	fmt.Println("Attribute mapping:")
+	keys := make([]string, 0, len(provider.AttributeMapping))
+	for key := range provider.AttributeMapping {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Printf("  %s = %s\n", key, provider.AttributeMapping[key])
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// projectSnapshot is the workload identity configuration of a project, normalized for comparison
+type projectSnapshot struct {
+	projectID     string
+	projectNumber string
+	// pools holds the configuration of each pool, keyed by pool ID
+	pools map[string]Pool
+	// providers holds the providers of each pool, keyed by provider ID
+	providers map[string]map[string]Provider
+	bindings  []string
+}
+
+// DiffProjects structurally compares the pools, providers and service account bindings of two projects.
+// Project numbers and IDs are normalized out, so only intended differences are reported.
+func DiffProjects(projectA, projectB string) error {
+	a, err := loadProjectSnapshot(projectA)
+	if err != nil {
+		return err
+	}
+	b, err := loadProjectSnapshot(projectB)
+	if err != nil {
+		return err
+	}
+
+	var differences []string
+	for _, pool := range unionKeys(a.pools, b.pools) {
+		poolA, inA := a.pools[pool]
+		poolB, inB := b.pools[pool]
+		switch {
+		case !inA:
+			differences = append(differences, fmt.Sprintf("pool %s: only in %s", pool, projectB))
+			continue
+		case !inB:
+			differences = append(differences, fmt.Sprintf("pool %s: only in %s", pool, projectA))
+			continue
+		}
+		differences = append(differences, diffPool(pool, a, b, poolA, poolB)...)
+
+		providersA, providersB := a.providers[pool], b.providers[pool]
+		for _, id := range unionKeys(providersA, providersB) {
+			providerA, inA := providersA[id]
+			providerB, inB := providersB[id]
+			name := pool + "/" + id
+			switch {
+			case !inA:
+				differences = append(differences, fmt.Sprintf("provider %s: only in %s", name, projectB))
+			case !inB:
+				differences = append(differences, fmt.Sprintf("provider %s: only in %s", name, projectA))
+			default:
+				differences = append(differences, diffProvider(name, a, b, providerA, providerB)...)
+			}
+		}
+	}
+
+	for _, binding := range a.bindings {
+		if !slices.Contains(b.bindings, binding) {
+			differences = append(differences, fmt.Sprintf("binding %s: only in %s", binding, projectA))
+		}
+	}
+	for _, binding := range b.bindings {
+		if !slices.Contains(a.bindings, binding) {
+			differences = append(differences, fmt.Sprintf("binding %s: only in %s", binding, projectB))
+		}
+	}
+
+	fmt.Printf("Comparing %s (%s) with %s (%s)\n", projectA, a.projectNumber, projectB, b.projectNumber)
+	fmt.Println()
+	if len(differences) == 0 {
+		fmt.Println("No differences - the workload identity configuration is identical.")
+		return nil
+	}
+	for _, difference := range differences {
+		fmt.Println(difference)
+	}
+	fmt.Println()
+	return fmt.Errorf("found %d difference(s) between %s and %s", len(differences), projectA, projectB)
+}
+
+func loadProjectSnapshot(projectID string) (*projectSnapshot, error) {
+	projectNumber, err := getProjectNumber(projectID)
+	if err != nil {
+		return nil, err
+	}
+	s := &projectSnapshot{projectID: projectID, projectNumber: projectNumber, pools: map[string]Pool{}, providers: map[string]map[string]Provider{}}
+
+	pools, err := ListPools(projectID, false)
+	if err != nil {
+		return nil, err
+	}
+	for _, pool := range pools {
+		setup, err := loadSetupPool(projectID, projectNumber, pool)
+		if err != nil {
+			return nil, err
+		}
+		s.pools[pool] = setup.Pool
+		s.providers[pool] = map[string]Provider{}
+		for _, provider := range setup.Providers {
+			s.providers[pool][provider.ID()] = provider
+		}
+	}
+
+	bindings, err := ListWorkloadIdentityBindings(projectID)
+	if err != nil {
+		return nil, err
+	}
+	for _, binding := range bindings {
+		line := fmt.Sprintf("%s -> %s (%s)", s.normalize(binding.Member), s.normalize(binding.ServiceAccount), strings.TrimPrefix(binding.Role, "roles/"))
+		if binding.Condition != nil {
+			line += " if " + binding.Condition.Expression
+		}
+		s.bindings = append(s.bindings, line)
+	}
+	slices.Sort(s.bindings)
+	return s, nil
+}
+
+// normalize replaces the project number in projects/NUMBER paths and the project ID in service
+// account emails with placeholders. Only whole path segments and domains match, so a project number
+// or ID that is part of a longer one is kept.
+func (s *projectSnapshot) normalize(v string) string {
+	number := regexp.MustCompile(`\bprojects/` + regexp.QuoteMeta(s.projectNumber) + `\b`)
+	v = number.ReplaceAllLiteralString(v, "projects/PROJECT_NUMBER")
+	email := regexp.MustCompile(`@` + regexp.QuoteMeta(s.projectID) + `\.iam\.gserviceaccount\.com\b`)
+	return email.ReplaceAllLiteralString(v, "@PROJECT_ID.iam.gserviceaccount.com")
+}
+
+func diffPool(name string, a, b *projectSnapshot, poolA, poolB Pool) []string {
+	var differences []string
+	compare := func(field, valueA, valueB string) {
+		differences = append(differences, diffField("pool "+name, field, a, b, valueA, valueB)...)
+	}
+
+	compare("display name", poolA.DisplayName, poolB.DisplayName)
+	compare("description", poolA.Description, poolB.Description)
+	compare("disabled", fmt.Sprint(poolA.Disabled), fmt.Sprint(poolB.Disabled))
+	return differences
+}
+
+func diffProvider(name string, a, b *projectSnapshot, providerA, providerB Provider) []string {
+	var differences []string
+	compare := func(field, valueA, valueB string) {
+		differences = append(differences, diffField("provider "+name, field, a, b, valueA, valueB)...)
+	}
+
+	compare("issuer", providerA.Oidc.IssuerURI, providerB.Oidc.IssuerURI)
+	compare("condition", providerA.AttributeCondition, providerB.AttributeCondition)
+	compare("allowed audiences", strings.Join(providerA.Oidc.AllowedAudiences, ","), strings.Join(providerB.Oidc.AllowedAudiences, ","))
+	compare("disabled", fmt.Sprint(providerA.Disabled), fmt.Sprint(providerB.Disabled))
+	for _, key := range unionKeys(providerA.AttributeMapping, providerB.AttributeMapping) {
+		compare("mapping "+key, providerA.AttributeMapping[key], providerB.AttributeMapping[key])
+	}
+	return differences
+}
+
+// diffField reports a field of a resource whose normalized values differ
+func diffField(resource, field string, a, b *projectSnapshot, valueA, valueB string) []string {
+	valueA, valueB = a.normalize(valueA), b.normalize(valueB)
+	if valueA == valueB {
+		return nil
+	}
+	return []string{fmt.Sprintf("%s: %s differs\n  %s: %s\n  %s: %s", resource, field, a.projectID, valueA, b.projectID, valueB)}
+}
+
+// unionKeys returns the sorted keys present in either map
+func unionKeys[V any](a, b map[string]V) []string {
+	keys := slices.Sorted(maps.Keys(a))
+	for _, key := range slices.Sorted(maps.Keys(b)) {
+		if _, ok := a[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
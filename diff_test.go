@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	s := &projectSnapshot{projectID: "prod", projectNumber: "123"}
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"principalSet://iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/p/attribute.repository/acme/api",
+			"principalSet://iam.googleapis.com/projects/PROJECT_NUMBER/locations/global/workloadIdentityPools/p/attribute.repository/acme/api"},
+		{"projects/123", "projects/PROJECT_NUMBER"},
+		{"deploy@prod.iam.gserviceaccount.com", "deploy@PROJECT_ID.iam.gserviceaccount.com"},
+		{"assertion.aud == 'https://iam.googleapis.com/projects/123/locations/global'", "assertion.aud == 'https://iam.googleapis.com/projects/PROJECT_NUMBER/locations/global'"},
+
+		// Near misses keep their values
+		{"projects/1234/locations/global", "projects/1234/locations/global"},
+		{"projects/0123/locations/global", "projects/0123/locations/global"},
+		{"subprojects/123/x", "subprojects/123/x"},
+		{"assertion.repository_id == '123'", "assertion.repository_id == '123'"},
+		{"deploy@prod-2.iam.gserviceaccount.com", "deploy@prod-2.iam.gserviceaccount.com"},
+		{"deploy@my-prod.iam.gserviceaccount.com", "deploy@my-prod.iam.gserviceaccount.com"},
+		{"deploy@prod.iam.gserviceaccount.community", "deploy@prod.iam.gserviceaccount.community"},
+		{"prod", "prod"},
+	}
+	for _, tt := range tests {
+		if got := s.normalize(tt.value); got != tt.want {
+			t.Errorf("normalize(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
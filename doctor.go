@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// minGcloudVersion is the oldest Google Cloud SDK release gwif is known to work with
+const minGcloudVersion = "400.0.0"
+
+// requiredPermissions are the project permissions gwif uses, with the predefined role granting them
+var requiredPermissions = map[string]string{
+	"iam.workloadIdentityPools.create":           "roles/iam.workloadIdentityPoolAdmin",
+	"iam.workloadIdentityPools.delete":           "roles/iam.workloadIdentityPoolAdmin",
+	"iam.workloadIdentityPools.get":              "roles/iam.workloadIdentityPoolAdmin",
+	"iam.workloadIdentityPools.list":             "roles/iam.workloadIdentityPoolAdmin",
+	"iam.workloadIdentityPools.undelete":         "roles/iam.workloadIdentityPoolAdmin",
+	"iam.workloadIdentityPoolProviders.create":   "roles/iam.workloadIdentityPoolAdmin",
+	"iam.workloadIdentityPoolProviders.delete":   "roles/iam.workloadIdentityPoolAdmin",
+	"iam.workloadIdentityPoolProviders.get":      "roles/iam.workloadIdentityPoolAdmin",
+	"iam.workloadIdentityPoolProviders.list":     "roles/iam.workloadIdentityPoolAdmin",
+	"iam.workloadIdentityPoolProviders.undelete": "roles/iam.workloadIdentityPoolAdmin",
+	"iam.serviceAccounts.create":                 "roles/iam.serviceAccountAdmin",
+	"iam.serviceAccounts.list":                   "roles/iam.serviceAccountAdmin",
+	"iam.serviceAccounts.getIamPolicy":           "roles/iam.serviceAccountAdmin",
+	"iam.serviceAccounts.setIamPolicy":           "roles/iam.serviceAccountAdmin",
+	"resourcemanager.projects.get":               "roles/browser",
+	"serviceusage.services.list":                 "roles/serviceusage.serviceUsageAdmin",
+	"serviceusage.services.enable":               "roles/serviceusage.serviceUsageAdmin",
+}
+
+// doctorCheck is one line of the doctor checklist
+type doctorCheck struct {
+	name        string
+	passed      bool
+	detail      string
+	remediation []string
+}
+
+func (c doctorCheck) print() {
+	status := "PASS"
+	if !c.passed {
+		status = "FAIL"
+	}
+	line := fmt.Sprintf("[%s] %s", status, c.name)
+	if c.detail != "" {
+		line += " - " + c.detail
+	}
+	fmt.Println(line)
+	if !c.passed {
+		for _, r := range c.remediation {
+			fmt.Printf("       %s\n", r)
+		}
+	}
+}
+
+// Doctor runs preflight checks for the environment gwif depends on and prints a checklist
+func Doctor(cfg *config) error {
+	var failed int
+	report := func(c doctorCheck) bool {
+		c.print()
+		if !c.passed {
+			failed++
+		}
+		return c.passed
+	}
+
+	if !report(checkGcloudInstalled()) {
+		return fmt.Errorf("gcloud is required for the remaining checks")
+	}
+	report(checkGcloudVersion())
+
+	account, check := checkAccount(cfg)
+	if !report(check) {
+		return fmt.Errorf("%d check(s) failed", failed)
+	}
+
+	projectID := cfg.projectID
+	if !report(checkProject(projectID)) {
+		return fmt.Errorf("%d check(s) failed", failed)
+	}
+
+	for _, c := range checkServices(projectID) {
+		report(c)
+	}
+	report(checkPermissions(projectID, account))
+
+	if failed > 0 {
+		return fmt.Errorf("%d check(s) failed", failed)
+	}
+	fmt.Println()
+	fmt.Println("All checks passed.")
+	return nil
+}
+
+func checkGcloudInstalled() doctorCheck {
+	path, err := exec.LookPath("gcloud")
+	if err != nil {
+		return doctorCheck{
+			name:        "gcloud installed",
+			remediation: []string{"Install the Google Cloud SDK: https://cloud.google.com/sdk/docs/install"},
+		}
+	}
+	return doctorCheck{name: "gcloud installed", passed: true, detail: path}
+}
+
+func checkGcloudVersion() doctorCheck {
+	check := doctorCheck{
+		name:        "gcloud version >= " + minGcloudVersion,
+		remediation: []string{"gcloud components update"},
+	}
+
+	output, err := gcloudCommand("version", "--format", "json").Output()
+	if err != nil {
+		check.detail = fmt.Sprintf("failed to get version: %v", err)
+		return check
+	}
+	var versions map[string]string
+	if err := json.Unmarshal(output, &versions); err != nil {
+		check.detail = fmt.Sprintf("failed to parse version: %v", err)
+		return check
+	}
+
+	version := versions["Google Cloud SDK"]
+	check.detail = version
+	check.passed = compareVersions(version, minGcloudVersion) >= 0
+	return check
+}
+
+// checkAccount verifies gcloud holds credentials for the account gwif runs as, and returns
+// the identity permissions are checked for (the impersonated service account when set)
+func checkAccount(cfg *config) (string, doctorCheck) {
+	check := doctorCheck{
+		name:        "gcloud account authenticated",
+		remediation: []string{strings.TrimSpace("gcloud auth login " + cfg.account)},
+	}
+
+	filter := "status:ACTIVE"
+	if cfg.account != "" {
+		filter = "account:" + cfg.account
+	}
+	output, err := gcloudCommand("auth", "list", "--filter", filter, "--format", "value(account)").Output()
+	if err != nil {
+		check.detail = fmt.Sprintf("failed to list accounts: %v", err)
+		return "", check
+	}
+	account := strings.TrimSpace(string(output))
+	if account == "" {
+		check.detail = "no credentialed account"
+		if cfg.account != "" {
+			check.detail = fmt.Sprintf("no credentials for %s", cfg.account)
+		}
+		return "", check
+	}
+	check.passed = true
+	check.detail = account
+
+	if cfg.impersonateServiceAccount != "" {
+		check.detail = fmt.Sprintf("%s impersonating %s", account, cfg.impersonateServiceAccount)
+		return cfg.impersonateServiceAccount, check
+	}
+	return account, check
+}
+
+func checkProject(projectID string) doctorCheck {
+	check := doctorCheck{name: fmt.Sprintf("project %s exists", projectID)}
+	if _, err := getProjectNumber(projectID); err != nil {
+		check.detail = "not found or no access"
+		check.remediation = []string{"gcloud projects list  # check the project ID and that your account can see it"}
+		return check
+	}
+	check.passed = true
+	return check
+}
+
+func checkServices(projectID string) []doctorCheck {
+	enabled, err := ListEnabledServices(projectID)
+	if err != nil {
+		return []doctorCheck{{
+			name:        "required APIs enabled",
+			detail:      err.Error(),
+			remediation: []string{"gcloud services enable serviceusage.googleapis.com --project " + projectID},
+		}}
+	}
+
+	var checks []doctorCheck
+	for _, service := range requiredServices {
+		checks = append(checks, doctorCheck{
+			name:        fmt.Sprintf("API %s enabled", service),
+			passed:      enabled[service],
+			remediation: []string{fmt.Sprintf("gcloud services enable %s --project %s", service, projectID)},
+		})
+	}
+	return checks
+}
+
+func checkPermissions(projectID, account string) doctorCheck {
+	check := doctorCheck{name: "caller holds the permissions gwif needs"}
+
+	permissions := slices.Sorted(maps.Keys(requiredPermissions))
+	granted, err := testProjectPermissions(projectID, permissions)
+	if err != nil {
+		check.detail = err.Error()
+		return check
+	}
+
+	var missing []string
+	roles := map[string]bool{}
+	for _, permission := range permissions {
+		if !granted[permission] {
+			missing = append(missing, permission)
+			roles[requiredPermissions[permission]] = true
+		}
+	}
+	if len(missing) == 0 {
+		check.passed = true
+		return check
+	}
+
+	check.detail = "missing " + strings.Join(missing, ", ")
+	member := "user:" + account
+	if strings.HasSuffix(account, ".gserviceaccount.com") {
+		member = "serviceAccount:" + account
+	}
+	for _, role := range slices.Sorted(maps.Keys(roles)) {
+		check.remediation = append(check.remediation,
+			fmt.Sprintf("gcloud projects add-iam-policy-binding %s --member %s --role %s", projectID, member, role))
+	}
+	return check
+}
+
+// testProjectPermissions calls testIamPermissions on the project and returns the permissions the caller holds
+func testProjectPermissions(projectID string, permissions []string) (map[string]bool, error) {
+	output, err := outputGcloud("get access token", gcloudCommand("auth", "print-access-token"))
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(map[string][]string{"permissions": permissions})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost,
+		fmt.Sprintf("https://cloudresourcemanager.googleapis.com/v1/projects/%s:testIamPermissions", projectID),
+		bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(output)))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := (&http.Client{Timeout: 30 * time.Second}).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to test permissions: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to test permissions: %s", resp.Status)
+	}
+
+	var result struct {
+		Permissions []string `json:"permissions"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to parse permissions: %v", err)
+	}
+	granted := map[string]bool{}
+	for _, permission := range result.Permissions {
+		granted[permission] = true
+	}
+	return granted, nil
+}
+
+// compareVersions compares dotted numeric versions like 502.0.0
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < max(len(as), len(bs)); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			return cmp.Compare(x, y)
+		}
+	}
+	return 0
+}
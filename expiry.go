@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// expiryTitlePrefix marks the IAM conditions of time-limited bindings, the title carries the expiry time
+const expiryTitlePrefix = "gwif-expires-"
+
+// parseExpiry parses --expires as a duration from now (e.g. 8h, 7d) or an RFC 3339 timestamp or date
+func parseExpiry(value string, now time.Time) (time.Time, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n > 0 {
+			return now.AddDate(0, 0, n), nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		if d <= 0 {
+			return time.Time{}, fmt.Errorf("invalid expiry %s: duration must be positive", value)
+		}
+		return now.Add(d), nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			if !t.After(now) {
+				return time.Time{}, fmt.Errorf("invalid expiry %s: already in the past", value)
+			}
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid expiry %s: expected a duration (e.g. 8h, 7d) or a timestamp (e.g. 2026-01-31 or 2026-01-31T18:00:00Z)", value)
+}
+
+// expiryCondition returns the IAM condition letting a binding lapse at expires
+func expiryCondition(expires time.Time) *IAMCondition {
+	timestamp := expires.UTC().Truncate(time.Second).Format(time.RFC3339)
+	return &IAMCondition{
+		Title:       expiryTitlePrefix + timestamp,
+		Description: "Time-limited binding added by gwif auth --expires",
+		Expression:  fmt.Sprintf("request.time < timestamp(%s)", celString(timestamp)),
+	}
+}
+
+// bindingExpiry returns the expiry time of a binding added with --expires
+func bindingExpiry(binding ServiceAccountBinding) (time.Time, bool) {
+	if binding.Condition == nil {
+		return time.Time{}, false
+	}
+	timestamp, ok := strings.CutPrefix(binding.Condition.Title, expiryTitlePrefix)
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339, timestamp)
+	return t, err == nil
+}
+
+// ListAuthBindings prints the workload identity bindings on the service accounts of the projects with their remaining validity
+func ListAuthBindings(projectIDs ...string) error {
+	bindings, err := ListWorkloadIdentityBindings(projectIDs...)
+	if err != nil {
+		return err
+	}
+	if len(bindings) == 0 {
+		fmt.Printf("No workload identity bindings found on service accounts in project %s\n", strings.Join(projectIDs, ", "))
+		return nil
+	}
+
+	now := time.Now()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SERVICE ACCOUNT\tPRINCIPAL\tROLE\tVALIDITY")
+	for _, binding := range bindings {
+		validity := "permanent"
+		if expires, ok := bindingExpiry(binding); ok {
+			validity = formatValidity(expires, now)
+		} else if binding.Condition != nil {
+			validity = "conditional: " + binding.Condition.Title
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", binding.ServiceAccount, binding.Principal, strings.TrimPrefix(binding.Role, "roles/"), validity)
+	}
+	return w.Flush()
+}
+
+// PruneExpiredBindings removes time-limited bindings that have lapsed, after confirmation
+func PruneExpiredBindings(projectIDs ...string) error {
+	bindings, err := ListWorkloadIdentityBindings(projectIDs...)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var expired []ServiceAccountBinding
+	var lines []string
+	for _, binding := range bindings {
+		if expires, ok := bindingExpiry(binding); ok && !expires.After(now) {
+			expired = append(expired, binding)
+			lines = append(lines, fmt.Sprintf("%s: %s (%s)", binding.ServiceAccount, binding.Principal, formatValidity(expires, now)))
+		}
+	}
+	printImpact("Expired bindings", lines)
+	if len(expired) == 0 {
+		return nil
+	}
+
+	if !Ask(fmt.Sprintf("Remove %d expired binding(s)?", len(expired))) {
+		return nil
+	}
+	for _, binding := range expired {
+		if err := RemoveServiceAccountBinding(projectIDs[0], binding); err != nil {
+			return err
+		}
+		fmt.Printf("Removed %s from %s\n", binding.Principal, binding.ServiceAccount)
+	}
+	return nil
+}
+
+// formatValidity describes the time left until expires, or how long ago it expired
+func formatValidity(expires, now time.Time) string {
+	remaining := expires.Sub(now)
+	if remaining <= 0 {
+		return fmt.Sprintf("expired %s ago (%s)", formatDays(-remaining), expires.Format(time.RFC3339))
+	}
+	return fmt.Sprintf("expires in %s (%s)", formatDays(remaining), expires.Format(time.RFC3339))
+}
+
+// formatDays formats d rounded to minutes, with days for durations over a day
+func formatDays(d time.Duration) string {
+	if d < time.Minute {
+		return "less than 1m"
+	}
+	d = d.Round(time.Minute)
+	days := d / (24 * time.Hour)
+	d -= days * 24 * time.Hour
+	s := strings.TrimSuffix(d.String(), "0s")
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	switch {
+	case days == 0:
+		return s
+	case d == 0:
+		return fmt.Sprintf("%dd", days)
+	}
+	return fmt.Sprintf("%dd%s", days, s)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatDays(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{10 * time.Second, "less than 1m"},
+		{5 * time.Minute, "5m"},
+		{90 * time.Minute, "1h30m"},
+		{2 * time.Hour, "2h"},
+		{24 * time.Hour, "1d"},
+		{50 * time.Hour, "2d2h"},
+		{7*24*time.Hour + 5*time.Minute, "7d5m"},
+	}
+	for _, tt := range tests {
+		if got := formatDays(tt.d); got != tt.want {
+			t.Errorf("formatDays(%s) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestParseExpiry(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{"8h", now.Add(8 * time.Hour)},
+		{"90m", now.Add(90 * time.Minute)},
+		{"1h30m", now.Add(90 * time.Minute)},
+		{"7d", now.AddDate(0, 0, 7)},
+		{"30d", time.Date(2026, 3, 31, 12, 0, 0, 0, time.UTC)},
+		{"2026-03-02", time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)},
+		{"2026-03-01T18:00:00Z", time.Date(2026, 3, 1, 18, 0, 0, 0, time.UTC)},
+		{"2026-03-01T14:00:00+01:00", time.Date(2026, 3, 1, 13, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := parseExpiry(tt.value, now)
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("parseExpiry(%q) = %v, %v, want %v", tt.value, got, err, tt.want)
+		}
+	}
+
+	invalid := []struct {
+		value string
+		want  string
+	}{
+		{"0s", "duration must be positive"},
+		{"-2h", "duration must be positive"},
+		{"0d", "expected a duration"},
+		{"-1d", "expected a duration"},
+		{"1.5d", "expected a duration"},
+		{"d", "expected a duration"},
+		{"", "expected a duration"},
+		{"7 days", "expected a duration"},
+		{"2026-03-01", "already in the past"},
+		{"2026-03-01T12:00:00Z", "already in the past"},
+		{"2026-02-30", "expected a duration"},
+		{"01/03/2026", "expected a duration"},
+	}
+	for _, tt := range invalid {
+		_, err := parseExpiry(tt.value, now)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("parseExpiry(%q) error = %v, want %q", tt.value, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Setup is the live workload identity configuration of a pool: the pool, its providers and
+// the service account bindings referencing it, as the pools, providers and auth commands create them
+type Setup struct {
+	ProjectID     string
+	ProjectNumber string
+	Pool          Pool
+	PoolID        string
+	Providers     []Provider
+	Bindings      []ServiceAccountBinding
+}
+
+// LoadSetup reads the pool, its active providers and the bindings referencing it on service accounts
+// in the pool's project and accountProjects
+func LoadSetup(projectID, projectNumber, poolName string, accountProjects ...string) (*Setup, error) {
+	setup, err := loadSetupPool(projectID, projectNumber, poolName)
+	if err != nil {
+		return nil, err
+	}
+	setup.Bindings, err = PoolBindings(projectNumber, poolName, uniqueProjects(projectID, accountProjects)...)
+	if err != nil {
+		return nil, err
+	}
+	return setup, nil
+}
+
+// loadSetupPool reads the pool and its active providers, without bindings
+func loadSetupPool(projectID, projectNumber, poolName string) (*Setup, error) {
+	pool, err := GetPool(projectID, poolName)
+	if err != nil {
+		return nil, err
+	}
+	if pool.State == "DELETED" {
+		return nil, fmt.Errorf("pool %s is deleted", poolName)
+	}
+
+	setup := &Setup{ProjectID: projectID, ProjectNumber: projectNumber, Pool: *pool, PoolID: poolName}
+	providers, err := ListProviders(projectID, poolName, false)
+	if err != nil {
+		return nil, err
+	}
+	for _, providerName := range providers {
+		provider, err := GetProvider(projectID, poolName, providerName)
+		if err != nil {
+			return nil, err
+		}
+		setup.Providers = append(setup.Providers, *provider)
+	}
+	return setup, nil
+}
+
+// Export writes the pool setup in the given format to cfg.outputFile, or stdout
+func Export(cfg *config, projectNumber string, render func(*Setup) string) error {
+	setup, err := LoadSetup(cfg.projectID, projectNumber, cfg.poolName, cfg.serviceAccountProjects...)
+	if err != nil {
+		return err
+	}
+
+	out := io.Writer(os.Stdout)
+	if cfg.outputFile != "" {
+		file, err := os.Create(cfg.outputFile)
+		if err != nil {
+			return fmt.Errorf("failed to create export: %v", err)
+		}
+		defer file.Close()
+		out = file
+	}
+	if _, err := io.WriteString(out, render(setup)); err != nil {
+		return fmt.Errorf("failed to write export: %v", err)
+	}
+	return nil
+}
+
+// ID returns the provider ID from its full resource name
+func (p Provider) ID() string {
+	return resourceName(p.Name)
+}
+
+// ServiceAccountResource returns the resource name of a service account, taking the project
+// from user-managed service account emails and falling back to the setup project
+func (s *Setup) ServiceAccountResource(email string) string {
+	return fmt.Sprintf("projects/%s/serviceAccounts/%s", serviceAccountEmailProject(email, s.ProjectID), email)
+}
+
+var nonIdentifierChars = regexp.MustCompile(`[^a-zA-Z0-9_]+`)
+
+// identifierName turns parts into a name usable as a Terraform resource name
+func identifierName(parts ...string) string {
+	name := strings.Trim(nonIdentifierChars.ReplaceAllString(strings.Join(parts, "_"), "_"), "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+	return strings.ToLower(name)
+}
+
+// uniqueNames hands out names, suffixing repeats so generated identifiers don't collide
+type uniqueNames struct {
+	separator string
+	seen      map[string]int
+}
+
+func newUniqueNames(separator string) *uniqueNames {
+	return &uniqueNames{separator: separator, seen: map[string]int{}}
+}
+
+func (u *uniqueNames) get(name string) string {
+	u.seen[name]++
+	if n := u.seen[name]; n > 1 {
+		return fmt.Sprintf("%s%s%d", name, u.separator, n)
+	}
+	return name
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// exportSetup is a pool with a conditional binding and a service account in another project
+func exportSetup(t *testing.T) *Setup {
+	provider := Provider{
+		Name:        "projects/123456789/locations/global/workloadIdentityPools/github/providers/acme",
+		DisplayName: "GitHub acme",
+		State:       "ACTIVE",
+		AttributeMapping: map[string]string{
+			"google.subject":       "assertion.sub",
+			"attribute.repository": "assertion.repository",
+			"attribute.ref":        "assertion.ref",
+		},
+		AttributeCondition: "assertion.repository_owner_id == \"1234\" &&\nassertion.ref.startsWith(\"refs/heads/\")",
+	}
+	provider.Oidc.IssuerURI = "https://token.actions.githubusercontent.com"
+	provider.Oidc.AllowedAudiences = []string{"https://iam.googleapis.com/acme"}
+
+	members := []string{
+		"principalSet://iam.googleapis.com/projects/123456789/locations/global/workloadIdentityPools/github/attribute.repository/acme/app",
+		"principal://iam.googleapis.com/projects/123456789/locations/global/workloadIdentityPools/github/subject/repo:acme/infra:ref:refs/heads/main",
+	}
+	var principals []WorkloadPrincipal
+	for _, member := range members {
+		p, ok := ParseWorkloadPrincipal(member)
+		if !ok {
+			t.Fatalf("ParseWorkloadPrincipal(%q) failed", member)
+		}
+		principals = append(principals, p)
+	}
+
+	return &Setup{
+		ProjectID:     "acme-ci",
+		ProjectNumber: "123456789",
+		PoolID:        "github",
+		Pool: Pool{
+			Name:        "projects/123456789/locations/global/workloadIdentityPools/github",
+			DisplayName: "GitHub",
+			Description: "GitHub Actions for acme",
+			State:       "ACTIVE",
+		},
+		Providers: []Provider{provider},
+		Bindings: []ServiceAccountBinding{
+			{
+				ServiceAccount: "deploy@acme-ci.iam.gserviceaccount.com",
+				Role:           "roles/iam.workloadIdentityUser",
+				Member:         members[0],
+				Principal:      principals[0],
+			},
+			{
+				ServiceAccount: "terraform@acme-prod.iam.gserviceaccount.com",
+				Role:           "roles/iam.workloadIdentityUser",
+				Member:         members[1],
+				Principal:      principals[1],
+				Condition: &IAMCondition{
+					Title:       "gwif-expires",
+					Description: "Expires 2026-12-31, added by gwif",
+					Expression:  `request.time < timestamp("2026-12-31T00:00:00Z")`,
+				},
+			},
+		},
+	}
+}
+
+func TestExportGolden(t *testing.T) {
+	tests := []struct {
+		golden string
+		render func(*Setup) string
+	}{
+		{"export.tf", RenderTerraform},
+		{"export.sh", RenderScript},
+		{"export.yaml", RenderConfigConnector},
+	}
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			got := tt.render(exportSetup(t))
+			path := filepath.Join("testdata", tt.golden+".golden")
+			if *updateGolden {
+				if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+					t.Fatalf("failed to write %s: %v", path, err)
+				}
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("failed to read %s: %v", path, err)
+			}
+			if got != string(want) {
+				t.Errorf("output differs from %s, rerun with -update to accept it:\n%s", path, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// orphanedBinding is a service account binding that can no longer be used, and why
+type orphanedBinding struct {
+	binding ServiceAccountBinding
+	reason  string
+}
+
+// GarbageCollect finds service account bindings referencing missing or deleted pools, or workflows
+// that no longer exist, and removes them when --apply is set
+func GarbageCollect(cfg *config, projectNumber string) error {
+	workflows, err := loadKnownWorkflows(cfg.checkoutDir, cfg.manifestFile)
+	if err != nil {
+		return err
+	}
+
+	bindings, err := ListWorkloadIdentityBindings(bindingProjects(cfg)...)
+	if err != nil {
+		return err
+	}
+	warnUnscannedProjects(cfg)
+
+	// repo_workflow and job_workflow values name their repository, only the workflows of the
+	// checked-out repository are known
+	repository := cfg.githubRepositoryOwner + "/" + cfg.githubRepository
+	if cfg.githubRepositoryOwner == "" || cfg.githubRepository == "" {
+		repository = checkoutRepository(cfg.checkoutDir)
+	}
+
+	states, err := newPoolStateCache(cfg.projectID, projectNumber)
+	if err != nil {
+		return err
+	}
+
+	var orphans []orphanedBinding
+	var unknown []string
+	for _, binding := range bindings {
+		p := binding.Principal
+		switch state := states.get(p.ProjectNumber, p.Pool); state {
+		case "DELETED":
+			orphans = append(orphans, orphanedBinding{binding, fmt.Sprintf("pool %s is deleted", p.Pool)})
+			continue
+		case "MISSING":
+			orphans = append(orphans, orphanedBinding{binding, fmt.Sprintf("pool %s does not exist in project %s", p.Pool, p.ProjectNumber)})
+			continue
+		case "UNKNOWN":
+			unknown = append(unknown, fmt.Sprintf("%s: %s (no access to project %s)", binding.ServiceAccount, p, p.ProjectNumber))
+			continue
+		}
+
+		if workflows == nil {
+			continue
+		}
+		if workflow, ok := missingWorkflow(p, repository, workflows); ok {
+			orphans = append(orphans, orphanedBinding{binding, fmt.Sprintf("workflow %s does not exist", workflow)})
+		}
+	}
+
+	fmt.Printf("Scanned %d workload identity binding(s) in project %s.\n", len(bindings), cfg.projectID)
+	if len(unknown) > 0 {
+		fmt.Println()
+		fmt.Println("Skipped (pool could not be checked):")
+		for _, line := range unknown {
+			fmt.Printf("  - %s\n", line)
+		}
+	}
+
+	fmt.Println()
+	if len(orphans) == 0 {
+		fmt.Println("No orphaned bindings found.")
+		return nil
+	}
+	fmt.Printf("Orphaned bindings (%d):\n", len(orphans))
+	for _, orphan := range orphans {
+		fmt.Printf("  - %s: %s (%s)\n", orphan.binding.ServiceAccount, orphan.binding.Principal, orphan.reason)
+	}
+
+	fmt.Println()
+	if !cfg.apply {
+		fmt.Println("Dry run - nothing was removed. Run with --apply to remove these bindings.")
+		return nil
+	}
+	if !Ask(fmt.Sprintf("Remove %d orphaned binding(s)?", len(orphans))) {
+		return nil
+	}
+	for _, orphan := range orphans {
+		if err := RemoveServiceAccountBinding(cfg.projectID, orphan.binding); err != nil {
+			return err
+		}
+		fmt.Printf("Removed %s from %s\n", orphan.binding.Principal, orphan.binding.ServiceAccount)
+	}
+	return nil
+}
+
+// poolStateCache resolves pool states, looking up pools in other projects only once
+type poolStateCache struct {
+	// projectNumber is the project whose pools were all listed up front
+	projectNumber string
+	states        map[string]string
+}
+
+func newPoolStateCache(projectID, projectNumber string) (*poolStateCache, error) {
+	c := &poolStateCache{projectNumber: projectNumber, states: map[string]string{}}
+	active, err := ListPools(projectID, false)
+	if err != nil {
+		return nil, err
+	}
+	deleted, err := ListPools(projectID, true)
+	if err != nil {
+		return nil, err
+	}
+	for _, pool := range active {
+		c.states[projectNumber+"/"+pool] = "ACTIVE"
+	}
+	for _, pool := range deleted {
+		c.states[projectNumber+"/"+pool] = "DELETED"
+	}
+	return c, nil
+}
+
+// get returns ACTIVE, DELETED, MISSING or UNKNOWN
+func (c *poolStateCache) get(projectNumber, pool string) string {
+	key := projectNumber + "/" + pool
+	if state, ok := c.states[key]; ok {
+		return state
+	}
+	// Pools in this project were all listed, only pools in other projects need a lookup
+	if projectNumber == c.projectNumber {
+		return "MISSING"
+	}
+
+	state := "UNKNOWN"
+	p, err := GetPool(projectNumber, pool)
+	switch {
+	case err == nil && p.State == "DELETED":
+		state = "DELETED"
+	case err == nil:
+		state = "ACTIVE"
+	case errors.Is(err, ErrNotFound):
+		state = "MISSING"
+	}
+	c.states[key] = state
+	return state
+}
+
+// missingWorkflow returns the workflow a binding on attribute.workflow, repo_workflow or job_workflow
+// names when it isn't one of workflows. repo_workflow and job_workflow bindings are only checked
+// when they name repository, as workflows lists the workflows of that repository.
+func missingWorkflow(p WorkloadPrincipal, repository string, workflows map[string]bool) (string, bool) {
+	if p.Kind != "attribute" {
+		return "", false
+	}
+	var workflow string
+	switch p.Attribute {
+	case "workflow":
+		workflow = p.Value
+	case "repo_workflow":
+		// owner/repo/workflow
+		i := strings.LastIndex(p.Value, "/")
+		if i < 0 || repository == "" || !strings.EqualFold(p.Value[:i], repository) {
+			return "", false
+		}
+		workflow = p.Value[i+1:]
+	case "job_workflow":
+		// owner/repo/.github/workflows/file.yml@ref
+		repo, file, found := strings.Cut(p.Value, "/.github/workflows/")
+		if !found || repository == "" || !strings.EqualFold(repo, repository) {
+			return "", false
+		}
+		workflow = strings.Split(file, ".")[0]
+	default:
+		return "", false
+	}
+	return workflow, !workflows[workflow]
+}
+
+// checkoutRepository returns the owner/repo of the GitHub origin remote of a checkout, or "" when unknown
+func checkoutRepository(checkoutDir string) string {
+	if checkoutDir == "" {
+		return ""
+	}
+	output, err := exec.Command("git", "-C", checkoutDir, "remote", "get-url", "origin").Output()
+	if err != nil {
+		return ""
+	}
+	return githubRemoteRepository(strings.TrimSpace(string(output)))
+}
+
+// githubRemoteRepository parses owner/repo from GitHub remote URLs like git@github.com:owner/repo.git
+func githubRemoteRepository(url string) string {
+	for _, prefix := range []string{"git@github.com:", "ssh://git@github.com/", "https://github.com/"} {
+		rest, ok := strings.CutPrefix(url, prefix)
+		if !ok {
+			continue
+		}
+		owner, repo, ok := strings.Cut(strings.TrimSuffix(strings.TrimSuffix(rest, "/"), ".git"), "/")
+		if ok && owner != "" && repo != "" && !strings.Contains(repo, "/") {
+			return owner + "/" + repo
+		}
+	}
+	return ""
+}
+
+// loadKnownWorkflows returns the workflow names (file names without extension, as mapped to
+// attribute.workflow) found in a local checkout or manifest, or nil when neither is given
+func loadKnownWorkflows(checkoutDir, manifestFile string) (map[string]bool, error) {
+	if checkoutDir == "" && manifestFile == "" {
+		return nil, nil
+	}
+
+	workflows := map[string]bool{}
+	if checkoutDir != "" {
+		entries, err := os.ReadDir(filepath.Join(checkoutDir, ".github", "workflows"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read workflows: %v", err)
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if entry.IsDir() || (!strings.HasSuffix(name, ".yml") && !strings.HasSuffix(name, ".yaml")) {
+				continue
+			}
+			workflows[strings.Split(name, ".")[0]] = true
+		}
+	}
+
+	if manifestFile != "" {
+		file, err := os.Open(manifestFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read manifest: %v", err)
+		}
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			workflows[line] = true
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read manifest: %v", err)
+		}
+	}
+	return workflows, nil
+}
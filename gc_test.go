@@ -0,0 +1,59 @@
+package main
+
+import "testing"
+
+func TestMissingWorkflow(t *testing.T) {
+	workflows := map[string]bool{"deploy": true, "release": true}
+	tests := []struct {
+		attribute string
+		value     string
+		want      string
+		missing   bool
+	}{
+		{"workflow", "deploy", "deploy", false},
+		{"workflow", "old", "old", true},
+		{"repo_workflow", "acme/api/deploy", "deploy", false},
+		{"repo_workflow", "acme/api/old", "old", true},
+		{"repo_workflow", "Acme/API/old", "old", true},
+		{"job_workflow", "acme/api/.github/workflows/release.yml@refs/tags/v1", "release", false},
+		{"job_workflow", "acme/api/.github/workflows/old.yaml@refs/heads/main", "old", true},
+
+		// Workflows of other repositories aren't known
+		{"repo_workflow", "acme/web/old", "", false},
+		{"job_workflow", "acme/shared/.github/workflows/old.yml@refs/tags/v1", "", false},
+		{"repository", "acme/api", "", false},
+	}
+	for _, tt := range tests {
+		p := WorkloadPrincipal{Kind: "attribute", Attribute: tt.attribute, Value: tt.value}
+		workflow, missing := missingWorkflow(p, "acme/api", workflows)
+		if missing != tt.missing || (missing && workflow != tt.want) {
+			t.Errorf("missingWorkflow(%s=%s) = %q, %v, want %q, %v", tt.attribute, tt.value, workflow, missing, tt.want, tt.missing)
+		}
+	}
+
+	// Without a known repository only attribute.workflow is checked
+	p := WorkloadPrincipal{Kind: "attribute", Attribute: "repo_workflow", Value: "acme/api/old"}
+	if _, missing := missingWorkflow(p, "", workflows); missing {
+		t.Errorf("missingWorkflow without a repository reports %s", p.Value)
+	}
+}
+
+func TestGithubRemoteRepository(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"git@github.com:acme/api.git", "acme/api"},
+		{"ssh://git@github.com/acme/api.git", "acme/api"},
+		{"https://github.com/acme/api", "acme/api"},
+		{"https://github.com/acme/api.git/", "acme/api"},
+		{"https://gitlab.com/acme/api.git", ""},
+		{"https://github.com/acme", ""},
+		{"https://github.com/acme/api/tree/main", ""},
+	}
+	for _, tt := range tests {
+		if got := githubRemoteRepository(tt.url); got != tt.want {
+			t.Errorf("githubRemoteRepository(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// gcloudFlags are appended to every gcloud invocation, so the account used
+// never depends on the active gcloud configuration
+var gcloudFlags []string
+
+// configureGcloud sets the account flags passed to every gcloud invocation
+func configureGcloud(cfg *config) {
+	gcloudFlags = nil
+	if cfg.account != "" {
+		gcloudFlags = append(gcloudFlags, "--account", cfg.account)
+	}
+	if cfg.impersonateServiceAccount != "" {
+		gcloudFlags = append(gcloudFlags, "--impersonate-service-account", cfg.impersonateServiceAccount)
+	}
+}
+
+// gcloudCommand returns a gcloud command with the global account flags applied
+func gcloudCommand(args ...string) *exec.Cmd {
+	return gcloudCommandContext(context.Background(), args...)
+}
+
+// gcloudCommandContext is gcloudCommand with a context that kills gcloud when done
+func gcloudCommandContext(ctx context.Context, args ...string) *exec.Cmd {
+	return exec.CommandContext(ctx, "gcloud", append(args, gcloudFlags...)...)
+}
+
+// Kinds of gcloud failures, match them with errors.Is
+var (
+	ErrPermissionDenied = errors.New("permission denied")
+	ErrNotFound         = errors.New("not found")
+	ErrAlreadyExists    = errors.New("already exists")
+	ErrAPIDisabled      = errors.New("API not enabled")
+	ErrDeletedNameInUse = errors.New("name is held by a deleted resource")
+	ErrQuotaExceeded    = errors.New("quota exceeded")
+)
+
+// GcloudError is a failed gcloud invocation, classified from its stderr
+type GcloudError struct {
+	// Op describes what gwif was doing, e.g. "create provider"
+	Op string
+	// Kind is one of the Err* kinds, nil when the failure couldn't be classified
+	Kind error
+	// Message is the error gcloud printed
+	Message string
+	// Permission is the missing permission for ErrPermissionDenied, when gcloud names it
+	Permission string
+	// Service is the disabled API for ErrAPIDisabled
+	Service string
+	// Guidance overrides the default hint for the kind
+	Guidance string
+	Err      error
+}
+
+func (e *GcloudError) Error() string {
+	return fmt.Sprintf("failed to %s: %s", e.Op, e.Message)
+}
+
+func (e *GcloudError) Unwrap() []error {
+	if e.Kind == nil {
+		return []error{e.Err}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// Hint returns what the user can do about the error
+func (e *GcloudError) Hint() string {
+	if e.Guidance != "" {
+		return e.Guidance
+	}
+	switch e.Kind {
+	case ErrPermissionDenied:
+		if e.Permission != "" {
+			return fmt.Sprintf("your account is missing the %s permission - run gwif doctor to see which roles to grant", e.Permission)
+		}
+		return "your account lacks a required permission - run gwif doctor to see which roles to grant"
+	case ErrAPIDisabled:
+		if e.Service != "" {
+			return fmt.Sprintf("enable the API with: gcloud services enable %s --project <project-id>", e.Service)
+		}
+		return "a required API is disabled - run gwif doctor to see which"
+	case ErrNotFound:
+		return "check the name and that it lives in the selected --project"
+	case ErrAlreadyExists:
+		return "choose another name, or reuse the existing resource"
+	case ErrDeletedNameInUse:
+		return "deleted resources keep their name for 30 days - restore it or choose another name"
+	case ErrQuotaExceeded:
+		return "delete unused resources (deleted ones count until purged after 30 days) or request a quota increase"
+	}
+	return ""
+}
+
+var (
+	gcloudErrorLine       = regexp.MustCompile(`(?m)^ERROR: (?:\([^)]*\) )?(.*)$`)
+	missingPermission     = regexp.MustCompile(`[Pp]ermission '?([a-z]+\.[a-zA-Z]+\.[a-zA-Z]+)'?`)
+	disabledService       = regexp.MustCompile(`([a-z0-9-]+\.googleapis\.com)`)
+	apiDisabledIndicators = []string{"SERVICE_DISABLED", "has not been used in project", "it is disabled", "API has not been used"}
+)
+
+// classifyGcloudError turns gcloud stderr output into a GcloudError
+func classifyGcloudError(op string, stderr string, err error) *GcloudError {
+	e := &GcloudError{Op: op, Message: err.Error(), Err: err}
+	if m := gcloudErrorLine.FindAllStringSubmatch(stderr, -1); m != nil {
+		e.Message = strings.TrimSpace(m[len(m)-1][1])
+	} else if s := strings.TrimSpace(stderr); s != "" {
+		lines := strings.Split(s, "\n")
+		e.Message = lines[len(lines)-1]
+	}
+
+	// Only classify the error itself, gcloud warnings printed before it mention things like quota projects
+	text := stderr
+	if i := strings.Index(stderr, "ERROR:"); i >= 0 {
+		text = stderr[i:]
+	}
+
+	switch {
+	// Disabled APIs are reported as PERMISSION_DENIED, so check them first
+	case containsAny(text, apiDisabledIndicators):
+		e.Kind = ErrAPIDisabled
+		if m := disabledService.FindStringSubmatch(text); m != nil {
+			e.Service = m[1]
+		}
+	case containsAny(text, []string{"PERMISSION_DENIED", "does not have permission", "Permission denied", "denied on resource"}):
+		e.Kind = ErrPermissionDenied
+		if m := missingPermission.FindStringSubmatch(text); m != nil {
+			e.Permission = m[1]
+		}
+	case containsAny(text, []string{"RESOURCE_EXHAUSTED", "Quota exceeded", "quota exceeded", "Quota limit"}):
+		e.Kind = ErrQuotaExceeded
+	case containsAny(text, []string{"ALREADY_EXISTS", "already exists"}):
+		e.Kind = ErrAlreadyExists
+	case containsAny(text, []string{"NOT_FOUND", "not found"}):
+		e.Kind = ErrNotFound
+	}
+	return e
+}
+
+func containsAny(s string, substrings []string) bool {
+	for _, sub := range substrings {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// runGcloud runs cmd, showing its stderr to the user while capturing it to classify failures
+func runGcloud(op string, cmd *exec.Cmd) error {
+	var stderr bytes.Buffer
+	cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+	if err := cmd.Run(); err != nil {
+		return classifyGcloudError(op, stderr.String(), err)
+	}
+	return nil
+}
+
+// outputGcloud runs cmd and returns its stdout, capturing stderr to classify failures
+func outputGcloud(op string, cmd *exec.Cmd) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, classifyGcloudError(op, stderr.String(), err)
+	}
+	return output, nil
+}
+
+// printError prints err and, for classified gcloud failures, what to do about it
+func printError(err error) {
+	log.Println(err)
+	var gcloudErr *GcloudError
+	if errors.As(err, &gcloudErr) {
+		if hint := gcloudErr.Hint(); hint != "" {
+			log.Println("hint: " + hint)
+		}
+	}
+}
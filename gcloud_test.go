@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestClassifyGcloudError(t *testing.T) {
+	tests := []struct {
+		name       string
+		stderr     string
+		kind       error
+		message    string
+		permission string
+		service    string
+	}{
+		{
+			name:    "api disabled",
+			stderr:  "ERROR: (gcloud.iam.workload-identity-pools.create) PERMISSION_DENIED: Identity and Access Management (IAM) API has not been used in project 123 before or it is disabled. Enable it by visiting https://console.developers.google.com/apis/api/iam.googleapis.com/overview?project=123",
+			kind:    ErrAPIDisabled,
+			message: "PERMISSION_DENIED: Identity and Access Management (IAM) API has not been used in project 123 before or it is disabled. Enable it by visiting https://console.developers.google.com/apis/api/iam.googleapis.com/overview?project=123",
+			service: "iam.googleapis.com",
+		},
+		{
+			name:       "permission denied",
+			stderr:     "ERROR: (gcloud.iam.service-accounts.create) PERMISSION_DENIED: Permission 'iam.serviceAccounts.create' denied on resource (or it may not exist).",
+			kind:       ErrPermissionDenied,
+			message:    "PERMISSION_DENIED: Permission 'iam.serviceAccounts.create' denied on resource (or it may not exist).",
+			permission: "iam.serviceAccounts.create",
+		},
+		{
+			name:    "permission denied without permission name",
+			stderr:  "ERROR: (gcloud.projects.get-iam-policy) User [me@example.com] does not have permission to access projects instance [p]",
+			kind:    ErrPermissionDenied,
+			message: "User [me@example.com] does not have permission to access projects instance [p]",
+		},
+		{
+			name:    "quota exceeded",
+			stderr:  "ERROR: (gcloud.iam.workload-identity-pools.create) RESOURCE_EXHAUSTED: Quota limit reached for pools.",
+			kind:    ErrQuotaExceeded,
+			message: "RESOURCE_EXHAUSTED: Quota limit reached for pools.",
+		},
+		{
+			name:    "already exists",
+			stderr:  "ERROR: (gcloud.iam.workload-identity-pools.create) ALREADY_EXISTS: Requested entity already exists",
+			kind:    ErrAlreadyExists,
+			message: "ALREADY_EXISTS: Requested entity already exists",
+		},
+		{
+			name:    "not found",
+			stderr:  "ERROR: (gcloud.iam.workload-identity-pools.describe) NOT_FOUND: Requested entity was not found.",
+			kind:    ErrNotFound,
+			message: "NOT_FOUND: Requested entity was not found.",
+		},
+		{
+			name:    "warning before the error is not classified",
+			stderr:  "WARNING: Your active project does not match the quota project in your local Application Default Credentials file.\nERROR: (gcloud.iam.workload-identity-pools.describe) NOT_FOUND: Requested entity was not found.",
+			kind:    ErrNotFound,
+			message: "NOT_FOUND: Requested entity was not found.",
+		},
+		{
+			name:    "last error line wins",
+			stderr:  "ERROR: first\nERROR: (gcloud.iam) second",
+			message: "second",
+		},
+		{
+			name:    "unclassified uses last stderr line",
+			stderr:  "something went wrong\nconnection reset by peer\n",
+			message: "connection reset by peer",
+		},
+		{
+			name:    "empty stderr uses the exec error",
+			message: "exit status 1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := errors.New("exit status 1")
+			got := classifyGcloudError("create pool", tt.stderr, err)
+			if got.Kind != tt.kind {
+				t.Errorf("Kind = %v, want %v", got.Kind, tt.kind)
+			}
+			if got.Message != tt.message {
+				t.Errorf("Message = %q, want %q", got.Message, tt.message)
+			}
+			if got.Permission != tt.permission {
+				t.Errorf("Permission = %q, want %q", got.Permission, tt.permission)
+			}
+			if got.Service != tt.service {
+				t.Errorf("Service = %q, want %q", got.Service, tt.service)
+			}
+			if !errors.Is(got, err) {
+				t.Errorf("errors.Is(got, err) = false, want true")
+			}
+			if tt.kind != nil && !errors.Is(got, tt.kind) {
+				t.Errorf("errors.Is(got, %v) = false, want true", tt.kind)
+			}
+		})
+	}
+}
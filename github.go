@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GitHubClient resolves GitHub owners and repositories to their numeric IDs and back.
+// Names can be reclaimed by someone else after a rename, IDs cannot.
+type GitHubClient interface {
+	RepositoryIDs(owner, repo string) (ownerID, repoID string, err error)
+	OwnerID(owner string) (string, error)
+	RepositoryName(repoID string) (string, error)
+	OwnerName(ownerID string) (string, error)
+	// Workflows returns the paths of a repository's workflow files, e.g. .github/workflows/deploy.yml
+	Workflows(owner, repo string) ([]string, error)
+	Environments(owner, repo string) ([]string, error)
+}
+
+// NewGitHubClient returns a client for the GitHub REST API.
+// GITHUB_API_URL can point it at GitHub Enterprise Server or a local stand-in,
+// and GITHUB_TOKEN is used for authentication when set (required for private repositories).
+func NewGitHubClient() GitHubClient {
+	baseURL := os.Getenv("GITHUB_API_URL")
+	if baseURL == "" {
+		baseURL = "https://api.github.com"
+	}
+	return &githubAPIClient{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		token:   os.Getenv("GITHUB_TOKEN"),
+		http:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+type githubAPIClient struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+type githubAccount struct {
+	ID    int64  `json:"id"`
+	Login string `json:"login"`
+}
+
+type githubRepository struct {
+	ID       int64         `json:"id"`
+	FullName string        `json:"full_name"`
+	Owner    githubAccount `json:"owner"`
+}
+
+func (c *githubAPIClient) RepositoryIDs(owner, repo string) (string, string, error) {
+	var r githubRepository
+	if err := c.get(fmt.Sprintf("/repos/%s/%s", owner, repo), &r); err != nil {
+		return "", "", fmt.Errorf("failed to look up repository %s/%s: %v", owner, repo, err)
+	}
+	return strconv.FormatInt(r.Owner.ID, 10), strconv.FormatInt(r.ID, 10), nil
+}
+
+func (c *githubAPIClient) OwnerID(owner string) (string, error) {
+	var a githubAccount
+	if err := c.get("/users/"+owner, &a); err != nil {
+		return "", fmt.Errorf("failed to look up owner %s: %v", owner, err)
+	}
+	return strconv.FormatInt(a.ID, 10), nil
+}
+
+func (c *githubAPIClient) RepositoryName(repoID string) (string, error) {
+	var r githubRepository
+	if err := c.get("/repositories/"+repoID, &r); err != nil {
+		return "", fmt.Errorf("failed to look up repository %s: %v", repoID, err)
+	}
+	return r.FullName, nil
+}
+
+func (c *githubAPIClient) OwnerName(ownerID string) (string, error) {
+	var a githubAccount
+	if err := c.get("/user/"+ownerID, &a); err != nil {
+		return "", fmt.Errorf("failed to look up owner %s: %v", ownerID, err)
+	}
+	return a.Login, nil
+}
+
+func (c *githubAPIClient) Workflows(owner, repo string) ([]string, error) {
+	var r struct {
+		Workflows []struct {
+			Path string `json:"path"`
+		} `json:"workflows"`
+	}
+	if err := c.get(fmt.Sprintf("/repos/%s/%s/actions/workflows?per_page=100", owner, repo), &r); err != nil {
+		return nil, fmt.Errorf("failed to list workflows of %s/%s: %v", owner, repo, err)
+	}
+	paths := make([]string, len(r.Workflows))
+	for i, w := range r.Workflows {
+		paths[i] = w.Path
+	}
+	return paths, nil
+}
+
+func (c *githubAPIClient) Environments(owner, repo string) ([]string, error) {
+	var r struct {
+		Environments []struct {
+			Name string `json:"name"`
+		} `json:"environments"`
+	}
+	if err := c.get(fmt.Sprintf("/repos/%s/%s/environments?per_page=100", owner, repo), &r); err != nil {
+		return nil, fmt.Errorf("failed to list environments of %s/%s: %v", owner, repo, err)
+	}
+	names := make([]string, len(r.Environments))
+	for i, e := range r.Environments {
+		names[i] = e.Name
+	}
+	return names, nil
+}
+
+func (c *githubAPIClient) get(path string, v any) error {
+	req, err := http.NewRequest(http.MethodGet, c.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GitHub API returned %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// isNumericID reports whether s looks like a GitHub numeric ID
+func isNumericID(s string) bool {
+	if s == "" {
+		return false
+	}
+	_, err := strconv.ParseUint(s, 10, 64)
+	return err == nil
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TrustGraph is the chain of pools, providers, bindings and service accounts in a project
+type TrustGraph struct {
+	Nodes []GraphNode
+	Edges []GraphEdge
+	ids   map[string]string
+}
+
+// GraphNode is a pool, provider or service account
+type GraphNode struct {
+	ID string
+	// Kind is one of pool, provider or serviceAccount
+	Kind  string
+	Lines []string
+}
+
+// GraphEdge connects a pool to its providers, and a pool to the service accounts its identities can use
+type GraphEdge struct {
+	From  string
+	To    string
+	Label string
+}
+
+// node returns the ID of the node for key, adding it with lines when it doesn't exist yet
+func (g *TrustGraph) node(key, kind string, lines ...string) string {
+	if id, ok := g.ids[key]; ok {
+		return id
+	}
+	id := fmt.Sprintf("n%d", len(g.Nodes))
+	g.ids[key] = id
+	g.Nodes = append(g.Nodes, GraphNode{ID: id, Kind: kind, Lines: lines})
+	return id
+}
+
+// BuildTrustGraph collects the pools, providers and workload identity bindings of a project,
+// including bindings on service accounts in accountProjects
+func BuildTrustGraph(projectID, projectNumber string, accountProjects []string) (*TrustGraph, error) {
+	g := &TrustGraph{ids: map[string]string{}}
+
+	pools, err := ListPools(projectID, false)
+	if err != nil {
+		return nil, err
+	}
+	for _, pool := range pools {
+		poolID := g.node(projectNumber+"/"+pool, "pool", "pool: "+pool)
+		providers, err := ListProviders(projectID, pool, false)
+		if err != nil {
+			return nil, err
+		}
+		for _, providerName := range providers {
+			provider, err := GetProvider(projectID, pool, providerName)
+			if err != nil {
+				return nil, err
+			}
+			lines := []string{"provider: " + providerName}
+			if provider.Disabled {
+				lines = append(lines, "(disabled)")
+			}
+			lines = append(lines, provider.AttributeCondition)
+			g.Edges = append(g.Edges, GraphEdge{From: poolID, To: g.node(provider.Name, "provider", lines...)})
+		}
+	}
+
+	bindings, err := ListWorkloadIdentityBindings(uniqueProjects(projectID, accountProjects)...)
+	if err != nil {
+		return nil, err
+	}
+	// Service accounts hold roles in their own project, which can differ from the pool's
+	policies := map[string]*IAMPolicy{}
+	for _, binding := range bindings {
+		p := binding.Principal
+		label := p.String()
+		if p.ProjectNumber != projectNumber {
+			label = fmt.Sprintf("project %s pool %s: %s", p.ProjectNumber, p.Pool, label)
+		}
+		if binding.Role != workloadIdentityUserRole {
+			label += " as " + strings.TrimPrefix(binding.Role, "roles/")
+		}
+		if binding.Condition != nil {
+			label += " if " + binding.Condition.Title
+		}
+
+		poolID := g.node(p.ProjectNumber+"/"+p.Pool, "pool", fmt.Sprintf("pool: %s (project %s)", p.Pool, p.ProjectNumber))
+		lines := []string{binding.ServiceAccount}
+		accountProject := serviceAccountEmailProject(binding.ServiceAccount, projectID)
+		policy, scanned := policies[accountProject]
+		if !scanned {
+			policy, err = GetProjectPolicy(accountProject)
+			if err != nil && accountProject == projectID {
+				return nil, err
+			}
+			policies[accountProject] = policy
+		}
+		if policy != nil {
+			lines = append(lines, policy.MemberRoles("serviceAccount:"+binding.ServiceAccount)...)
+		} else {
+			lines = append(lines, "(roles not scanned)")
+		}
+		accountID := g.node("serviceAccount:"+binding.ServiceAccount, "serviceAccount", lines...)
+		g.Edges = append(g.Edges, GraphEdge{From: poolID, To: accountID, Label: label})
+	}
+	return g, nil
+}
+
+// RenderMermaid renders the graph as a Mermaid flowchart
+func RenderMermaid(g *TrustGraph) string {
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+	for _, n := range g.Nodes {
+		label := mermaidEscape(n.Lines)
+		switch n.Kind {
+		case "pool":
+			fmt.Fprintf(&b, "    %s{{\"%s\"}}\n", n.ID, label)
+		case "provider":
+			fmt.Fprintf(&b, "    %s[\"%s\"]\n", n.ID, label)
+		default:
+			fmt.Fprintf(&b, "    %s([\"%s\"])\n", n.ID, label)
+		}
+	}
+	for _, e := range g.Edges {
+		if e.Label == "" {
+			fmt.Fprintf(&b, "    %s --> %s\n", e.From, e.To)
+			continue
+		}
+		fmt.Fprintf(&b, "    %s -- \"%s\" --> %s\n", e.From, mermaidEscape([]string{e.Label}), e.To)
+	}
+	return b.String()
+}
+
+// RenderDOT renders the graph in the Graphviz DOT language
+func RenderDOT(g *TrustGraph) string {
+	shapes := map[string]string{"pool": "hexagon", "provider": "box", "serviceAccount": "ellipse"}
+
+	var b strings.Builder
+	b.WriteString("digraph gwif {\n    rankdir=LR;\n")
+	for _, n := range g.Nodes {
+		fmt.Fprintf(&b, "    %s [shape=%s, label=\"%s\"];\n", n.ID, shapes[n.Kind], dotEscape(n.Lines))
+	}
+	for _, e := range g.Edges {
+		if e.Label == "" {
+			fmt.Fprintf(&b, "    %s -> %s;\n", e.From, e.To)
+			continue
+		}
+		fmt.Fprintf(&b, "    %s -> %s [label=\"%s\"];\n", e.From, e.To, dotEscape([]string{e.Label}))
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// mermaidEscape joins lines into a quoted Mermaid label, quotes and angle brackets need entity codes
+func mermaidEscape(lines []string) string {
+	replacer := strings.NewReplacer(`"`, "#quot;", "<", "#lt;", ">", "#gt;")
+	escaped := make([]string, len(lines))
+	for i, line := range lines {
+		escaped[i] = replacer.Replace(line)
+	}
+	return strings.Join(escaped, "<br/>")
+}
+
+func dotEscape(lines []string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	escaped := make([]string, len(lines))
+	for i, line := range lines {
+		escaped[i] = replacer.Replace(line)
+	}
+	return strings.Join(escaped, `\n`)
+}
+
+// Graph prints the trust graph of the project in the given format
+func Graph(cfg *config, projectNumber string) error {
+	var render func(*TrustGraph) string
+	switch cfg.format {
+	case "mermaid":
+		render = RenderMermaid
+	case "dot":
+		render = RenderDOT
+	default:
+		return fmt.Errorf("unknown graph format %q, use mermaid or dot", cfg.format)
+	}
+
+	g, err := BuildTrustGraph(cfg.projectID, projectNumber, cfg.serviceAccountProjects)
+	if err != nil {
+		return err
+	}
+	fmt.Print(render(g))
+	return nil
+}
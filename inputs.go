@@ -48,3 +48,9 @@ func GetInput(prompt string) string {
 	}
 	return scanner.Text()
 }
+
+// stdoutIsTerminal reports whether stdout is a terminal, rather than redirected to a file or pipe
+func stdoutIsTerminal() bool {
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
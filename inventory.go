@@ -0,0 +1,339 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// InventoryReport is the workload identity setup of every project walked by gwif inventory
+type InventoryReport struct {
+	GeneratedAt time.Time          `json:"generatedAt"`
+	Projects    []ProjectInventory `json:"projects"`
+}
+
+// ProjectInventory is the workload identity setup of one project
+type ProjectInventory struct {
+	ProjectID     string             `json:"projectId"`
+	ProjectNumber string             `json:"projectNumber"`
+	Pools         []InventoryPool    `json:"pools"`
+	Bindings      []InventoryBinding `json:"bindings"`
+	// Skipped explains why a project without workload identity wasn't inspected, e.g. a disabled IAM API
+	Skipped string `json:"skipped,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+type InventoryPool struct {
+	Name      string              `json:"name"`
+	State     string              `json:"state"`
+	Disabled  bool                `json:"disabled"`
+	Providers []InventoryProvider `json:"providers"`
+}
+
+type InventoryProvider struct {
+	Name             string            `json:"name"`
+	State            string            `json:"state"`
+	Disabled         bool              `json:"disabled"`
+	Issuer           string            `json:"issuer"`
+	Condition        string            `json:"condition"`
+	AttributeMapping map[string]string `json:"attributeMapping"`
+}
+
+type InventoryBinding struct {
+	ServiceAccount    string `json:"serviceAccount"`
+	Role              string `json:"role"`
+	Member            string `json:"member"`
+	PoolProjectNumber string `json:"poolProjectNumber"`
+	Pool              string `json:"pool"`
+	Condition         string `json:"condition,omitempty"`
+}
+
+// inventoryProject is a project to walk
+type inventoryProject struct {
+	id     string
+	number string
+}
+
+// Inventory walks the projects under the organization or folder (or every visible project)
+// with a bounded number of workers and writes a consolidated report
+func Inventory(cfg *config) error {
+	switch cfg.reportFormat {
+	case "json", "csv":
+	default:
+		return fmt.Errorf("unknown report format %q, use json or csv", cfg.reportFormat)
+	}
+	if cfg.organization != "" && cfg.folder != "" {
+		return fmt.Errorf("use either --organization or --folder, not both")
+	}
+	if cfg.workers < 1 {
+		return fmt.Errorf("--workers must be at least 1")
+	}
+
+	var projects []inventoryProject
+	var err error
+	switch {
+	case cfg.organization != "":
+		projects, err = listProjectsUnder("organization", cfg.organization)
+	case cfg.folder != "":
+		projects, err = listProjectsUnder("folder", cfg.folder)
+	default:
+		projects, err = listInventoryProjects("")
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Collecting workload identity configuration from %d project(s)...\n", len(projects))
+
+	report := InventoryReport{GeneratedAt: time.Now().UTC(), Projects: make([]ProjectInventory, len(projects))}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range cfg.workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				report.Projects[i] = collectProjectInventory(projects[i], cfg.projectTimeout)
+			}
+		}()
+	}
+	for i := range projects {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	sort.Slice(report.Projects, func(i, j int) bool {
+		return report.Projects[i].ProjectID < report.Projects[j].ProjectID
+	})
+
+	out := io.Writer(os.Stdout)
+	if cfg.outputFile != "" {
+		file, err := os.Create(cfg.outputFile)
+		if err != nil {
+			return fmt.Errorf("failed to create report: %v", err)
+		}
+		defer file.Close()
+		out = file
+	}
+	if cfg.reportFormat == "csv" {
+		err = writeInventoryCSV(out, report)
+	} else {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(report)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write report: %v", err)
+	}
+
+	var failed []string
+	for _, p := range report.Projects {
+		if p.Error != "" {
+			failed = append(failed, fmt.Sprintf("%s: %s", p.ProjectID, p.Error))
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Collected %d of %d project(s).\n", len(projects)-len(failed), len(projects))
+	if len(failed) > 0 {
+		fmt.Fprintf(os.Stderr, "Failed (%d), these are included in the report with their error:\n", len(failed))
+		for _, line := range failed {
+			fmt.Fprintf(os.Stderr, "  - %s\n", line)
+		}
+	}
+	return nil
+}
+
+// listInventoryProjects lists the visible projects matching filter, with their numbers
+func listInventoryProjects(filter string) ([]inventoryProject, error) {
+	cmd := gcloudCommand("projects", "list", "--format", "value(projectId,projectNumber)")
+	if filter != "" {
+		cmd.Args = append(cmd.Args, "--filter", filter)
+	}
+	output, err := outputGcloud("list projects", cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	var projects []inventoryProject
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		projects = append(projects, inventoryProject{id: fields[0], number: fields[1]})
+	}
+	return projects, nil
+}
+
+// listProjectsUnder returns the projects in an organization or folder, including those in nested folders
+func listProjectsUnder(parentType, parentID string) ([]inventoryProject, error) {
+	projects, err := listInventoryProjects(fmt.Sprintf("parent.type=%s AND parent.id=%s", parentType, parentID))
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := gcloudCommand("resource-manager", "folders", "list", "--"+parentType, parentID, "--format", "value(name)")
+	output, err := outputGcloud("list folders", cmd)
+	if err != nil {
+		return nil, err
+	}
+	for _, folder := range strings.Fields(string(output)) {
+		nested, err := listProjectsUnder("folder", strings.TrimPrefix(folder, "folders/"))
+		if err != nil {
+			return nil, err
+		}
+		projects = append(projects, nested...)
+	}
+	return projects, nil
+}
+
+// collectProjectInventory collects the pools, providers and bindings of a project,
+// recording failures in the result so one project can't fail the whole inventory
+func collectProjectInventory(project inventoryProject, timeout time.Duration) ProjectInventory {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	inventory := ProjectInventory{ProjectID: project.id, ProjectNumber: project.number}
+	err := collectPools(ctx, &inventory)
+	if err == nil {
+		err = collectBindings(ctx, &inventory)
+	}
+	switch {
+	case err == nil:
+	case ctx.Err() != nil:
+		inventory.Error = fmt.Sprintf("timed out after %s", timeout)
+	case errors.Is(err, ErrAPIDisabled):
+		// Projects that never used IAM don't have workload identity to report
+		inventory.Skipped = err.Error()
+	default:
+		inventory.Error = err.Error()
+	}
+	return inventory
+}
+
+func collectPools(ctx context.Context, inventory *ProjectInventory) error {
+	active, err := ListPoolDetailsContext(ctx, inventory.ProjectID, false)
+	if err != nil {
+		return err
+	}
+	deleted, err := ListPoolDetailsContext(ctx, inventory.ProjectID, true)
+	if err != nil {
+		return err
+	}
+
+	for _, pool := range append(active, deleted...) {
+		name := resourceName(pool.Name)
+		p := InventoryPool{Name: name, State: pool.State, Disabled: pool.Disabled, Providers: []InventoryProvider{}}
+		// Providers of a deleted pool can't be listed, and are gone with it
+		if pool.State == "DELETED" {
+			inventory.Pools = append(inventory.Pools, p)
+			continue
+		}
+
+		providers, err := ListProviderDetailsContext(ctx, inventory.ProjectID, name, false)
+		if err != nil {
+			return err
+		}
+		deletedProviders, err := ListProviderDetailsContext(ctx, inventory.ProjectID, name, true)
+		if err != nil {
+			return err
+		}
+		for _, provider := range append(providers, deletedProviders...) {
+			p.Providers = append(p.Providers, InventoryProvider{
+				Name:             resourceName(provider.Name),
+				State:            provider.State,
+				Disabled:         provider.Disabled,
+				Issuer:           provider.Oidc.IssuerURI,
+				Condition:        provider.AttributeCondition,
+				AttributeMapping: provider.AttributeMapping,
+			})
+		}
+		inventory.Pools = append(inventory.Pools, p)
+	}
+	return nil
+}
+
+func collectBindings(ctx context.Context, inventory *ProjectInventory) error {
+	bindings, err := ListWorkloadIdentityBindingsContext(ctx, inventory.ProjectID)
+	if err != nil {
+		return err
+	}
+	for _, binding := range bindings {
+		b := InventoryBinding{
+			ServiceAccount:    binding.ServiceAccount,
+			Role:              binding.Role,
+			Member:            binding.Member,
+			PoolProjectNumber: binding.Principal.ProjectNumber,
+			Pool:              binding.Principal.Pool,
+		}
+		if binding.Condition != nil {
+			b.Condition = binding.Condition.Expression
+		}
+		inventory.Bindings = append(inventory.Bindings, b)
+	}
+	return nil
+}
+
+// resourceName returns the last segment of a full resource name
+func resourceName(name string) string {
+	return name[strings.LastIndex(name, "/")+1:]
+}
+
+// writeInventoryCSV writes one row per provider, binding, skipped or failed project
+func writeInventoryCSV(w io.Writer, report InventoryReport) error {
+	writer := csv.NewWriter(w)
+	header := []string{"project_id", "project_number", "type", "pool", "provider", "state", "disabled", "condition", "service_account", "role", "member", "error"}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for _, p := range report.Projects {
+		row := func(kind string) []string {
+			r := make([]string, len(header))
+			r[0], r[1], r[2] = p.ProjectID, p.ProjectNumber, kind
+			return r
+		}
+
+		if p.Error != "" || p.Skipped != "" {
+			r := row("error")
+			r[11] = p.Error
+			if p.Skipped != "" {
+				r[2], r[11] = "skipped", p.Skipped
+			}
+			if err := writer.Write(r); err != nil {
+				return err
+			}
+		}
+		for _, pool := range p.Pools {
+			r := row("pool")
+			r[3], r[5], r[6] = pool.Name, pool.State, strconv.FormatBool(pool.Disabled)
+			if err := writer.Write(r); err != nil {
+				return err
+			}
+			for _, provider := range pool.Providers {
+				r := row("provider")
+				r[3], r[4], r[5], r[6], r[7] = pool.Name, provider.Name, provider.State, strconv.FormatBool(provider.Disabled), provider.Condition
+				if err := writer.Write(r); err != nil {
+					return err
+				}
+			}
+		}
+		for _, binding := range p.Bindings {
+			r := row("binding")
+			r[3], r[7], r[8], r[9], r[10] = binding.Pool, binding.Condition, binding.ServiceAccount, binding.Role, binding.Member
+			if err := writer.Write(r); err != nil {
+				return err
+			}
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const kccAPIVersion = "iam.cnrm.cloud.google.com/v1beta1"
+
+// RenderConfigConnector renders the setup as Config Connector manifests. Applying them acquires
+// the existing resources, as Config Connector adopts resources whose resourceID already exists.
+func RenderConfigConnector(s *Setup) string {
+	names := newUniqueNames("-")
+	var docs []string
+
+	poolName := names.get(kubernetesName(s.PoolID))
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Workload identity pool %s in project %s, exported by gwif\n", s.PoolID, s.ProjectID)
+	writeKCCHeader(&b, "IAMWorkloadIdentityPool", poolName)
+	b.WriteString("spec:\n")
+	writeYAMLFields(&b, "  ", [][2]string{
+		{"resourceID", s.PoolID},
+		{"location", "global"},
+		{"displayName", s.Pool.DisplayName},
+		{"description", s.Pool.Description},
+	})
+	if s.Pool.Disabled {
+		b.WriteString("  disabled: true\n")
+	}
+	writeProjectRef(&b, s.ProjectID)
+	docs = append(docs, b.String())
+
+	for _, provider := range s.Providers {
+		var b strings.Builder
+		writeKCCHeader(&b, "IAMWorkloadIdentityPoolProvider", names.get(kubernetesName(s.PoolID, provider.ID())))
+		b.WriteString("spec:\n")
+		writeYAMLFields(&b, "  ", [][2]string{
+			{"resourceID", provider.ID()},
+			{"location", "global"},
+			{"displayName", provider.DisplayName},
+			{"attributeCondition", provider.AttributeCondition},
+		})
+		if provider.Disabled {
+			b.WriteString("  disabled: true\n")
+		}
+		writeProjectRef(&b, s.ProjectID)
+		fmt.Fprintf(&b, "  workloadIdentityPoolRef:\n    name: %s\n", poolName)
+
+		b.WriteString("  attributeMapping:\n")
+		for _, key := range slices.Sorted(maps.Keys(provider.AttributeMapping)) {
+			fmt.Fprintf(&b, "    %s: %s\n", yamlScalar(key), yamlScalar(provider.AttributeMapping[key]))
+		}
+		b.WriteString("  oidc:\n")
+		fmt.Fprintf(&b, "    issuerUri: %s\n", yamlScalar(provider.Oidc.IssuerURI))
+		if len(provider.Oidc.AllowedAudiences) > 0 {
+			b.WriteString("    allowedAudiences:\n")
+			for _, audience := range provider.Oidc.AllowedAudiences {
+				fmt.Fprintf(&b, "      - %s\n", yamlScalar(audience))
+			}
+		}
+		docs = append(docs, b.String())
+	}
+
+	for _, binding := range s.Bindings {
+		account, _, _ := strings.Cut(binding.ServiceAccount, "@")
+		p := binding.Principal
+
+		var b strings.Builder
+		fmt.Fprintf(&b, "# %s can use %s\n", p, binding.ServiceAccount)
+		writeKCCHeader(&b, "IAMPolicyMember", names.get(kubernetesName(account, p.Kind, p.Attribute, p.Value)))
+		b.WriteString("spec:\n")
+		writeYAMLFields(&b, "  ", [][2]string{
+			{"member", binding.Member},
+			{"role", binding.Role},
+		})
+		b.WriteString("  resourceRef:\n")
+		writeYAMLFields(&b, "    ", [][2]string{
+			{"kind", "IAMServiceAccount"},
+			{"external", s.ServiceAccountResource(binding.ServiceAccount)},
+		})
+		if binding.Condition != nil {
+			b.WriteString("  condition:\n")
+			writeYAMLFields(&b, "    ", [][2]string{
+				{"title", binding.Condition.Title},
+				{"description", binding.Condition.Description},
+				{"expression", binding.Condition.Expression},
+			})
+		}
+		docs = append(docs, b.String())
+	}
+	return strings.Join(docs, "---\n")
+}
+
+func writeKCCHeader(b *strings.Builder, kind, name string) {
+	fmt.Fprintf(b, "apiVersion: %s\nkind: %s\nmetadata:\n  name: %s\n", kccAPIVersion, kind, name)
+}
+
+func writeProjectRef(b *strings.Builder, projectID string) {
+	fmt.Fprintf(b, "  projectRef:\n    external: %s\n", yamlScalar(projectID))
+}
+
+// writeYAMLFields writes key: value lines, skipping empty values
+func writeYAMLFields(b *strings.Builder, indent string, fields [][2]string) {
+	for _, f := range fields {
+		if f[1] != "" {
+			fmt.Fprintf(b, "%s%s: %s\n", indent, f[0], yamlScalar(f[1]))
+		}
+	}
+}
+
+var (
+	yamlPlain         = regexp.MustCompile(`^[a-zA-Z/][a-zA-Z0-9_./@-]*$`)
+	yamlReservedWords = []string{"true", "false", "null", "yes", "no", "on", "off", "y", "n", "~"}
+	nonKubernetesName = regexp.MustCompile(`[^a-z0-9-]+`)
+)
+
+// yamlScalar returns s as a plain YAML scalar when that is unambiguous, otherwise double quoted.
+// JSON strings are valid double quoted YAML scalars.
+func yamlScalar(s string) string {
+	if yamlPlain.MatchString(s) && !containsFold(yamlReservedWords, s) {
+		return s
+	}
+	var b strings.Builder
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	// Encoding a string can't fail, invalid UTF-8 is replaced rather than rejected
+	_ = encoder.Encode(s)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// kubernetesName turns parts into a valid Kubernetes object name
+func kubernetesName(parts ...string) string {
+	name := strings.Trim(nonKubernetesName.ReplaceAllString(strings.ToLower(strings.Join(parts, "-")), "-"), "-")
+	if len(name) > 60 {
+		name = strings.TrimRight(name[:60], "-")
+	}
+	if name == "" {
+		name = "gwif"
+	}
+	return name
+}
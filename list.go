@@ -2,83 +2,115 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"encoding/json"
 	"fmt"
 	"os"
-	"os/exec"
 	"strings"
 )
 
 // ListProjects returns a list of available GCP projects
 func ListProjects() ([]string, error) {
-	cmd := exec.Command("gcloud", "projects", "list", "--format", "value(projectId)")
-	output, err := cmd.Output()
+	cmd := gcloudCommand("projects", "list", "--format", "value(projectId)")
+	output, err := outputGcloud("list projects", cmd)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list projects: %v", err)
+		return nil, err
 	}
 	return strings.Split(strings.TrimSpace(string(output)), "\n"), nil
 }
 
 // ListPools returns a list of workload identity pools for a given project
 func ListPools(projectID string, showDeleted bool) ([]string, error) {
-	cmd := exec.Command("gcloud", "iam", "workload-identity-pools", "list",
+	return ListPoolsContext(context.Background(), projectID, showDeleted)
+}
+
+// ListPoolsContext is ListPools with a context that kills gcloud when done
+func ListPoolsContext(ctx context.Context, projectID string, showDeleted bool) ([]string, error) {
+	pools, err := ListPoolDetailsContext(ctx, projectID, showDeleted)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, pool := range pools {
+		names = append(names, resourceName(pool.Name))
+	}
+	return names, nil
+}
+
+// ListPoolDetailsContext returns the active pools of a project, or the deleted ones when showDeleted is set
+func ListPoolDetailsContext(ctx context.Context, projectID string, showDeleted bool) ([]Pool, error) {
+	cmd := gcloudCommandContext(ctx, "iam", "workload-identity-pools", "list",
 		"--project", projectID,
 		"--location", "global",
-		"--format", "value(name)")
+		"--format", "json")
 	if showDeleted {
 		cmd.Args = append(cmd.Args, "--show-deleted")
 		cmd.Args = append(cmd.Args, "--filter", "state:DELETED")
 	}
-	output, err := cmd.Output()
+	output, err := outputGcloud("list pools", cmd)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list pools: %v", err)
+		return nil, err
 	}
-	if len(output) == 0 {
-		return []string{}, nil
-	}
-	pools := strings.Split(strings.TrimSpace(string(output)), "\n")
-	// Extract just the pool name from the full resource name
-	for i, pool := range pools {
-		parts := strings.Split(pool, "/")
-		pools[i] = parts[len(parts)-1]
+	var pools []Pool
+	if err := json.Unmarshal(output, &pools); err != nil {
+		return nil, fmt.Errorf("failed to parse pools: %v", err)
 	}
 	return pools, nil
 }
 
 // ListProviders returns a list of workload identity providers for a given project and pool
 func ListProviders(projectID, poolName string, showDeleted bool) ([]string, error) {
-	cmd := exec.Command("gcloud", "iam", "workload-identity-pools", "providers", "list",
+	return ListProvidersContext(context.Background(), projectID, poolName, showDeleted)
+}
+
+// ListProvidersContext is ListProviders with a context that kills gcloud when done
+func ListProvidersContext(ctx context.Context, projectID, poolName string, showDeleted bool) ([]string, error) {
+	providers, err := ListProviderDetailsContext(ctx, projectID, poolName, showDeleted)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, provider := range providers {
+		names = append(names, resourceName(provider.Name))
+	}
+	return names, nil
+}
+
+// ListProviderDetailsContext returns the active providers of a pool, or the deleted ones when showDeleted is set
+func ListProviderDetailsContext(ctx context.Context, projectID, poolName string, showDeleted bool) ([]Provider, error) {
+	cmd := gcloudCommandContext(ctx, "iam", "workload-identity-pools", "providers", "list",
 		"--project", projectID,
 		"--location", "global",
 		"--workload-identity-pool", poolName,
-		"--format", "value(name)")
+		"--format", "json")
 	if showDeleted {
 		cmd.Args = append(cmd.Args, "--show-deleted")
 		cmd.Args = append(cmd.Args, "--filter", "state:DELETED")
 	}
-	output, err := cmd.Output()
+	output, err := outputGcloud("list providers", cmd)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list providers: %v", err)
-	}
-	if len(output) == 0 {
-		return []string{}, nil
+		return nil, err
 	}
-	providers := strings.Split(strings.TrimSpace(string(output)), "\n")
-	// Extract just the provider name from the full resource name
-	for i, provider := range providers {
-		parts := strings.Split(provider, "/")
-		providers[i] = parts[len(parts)-1]
+	var providers []Provider
+	if err := json.Unmarshal(output, &providers); err != nil {
+		return nil, fmt.Errorf("failed to parse providers: %v", err)
 	}
 	return providers, nil
 }
 
 // ListServiceAccounts returns a list of service accounts for a given project
 func ListServiceAccounts(projectID string) ([]string, error) {
-	cmd := exec.Command("gcloud", "iam", "service-accounts", "list",
+	return ListServiceAccountsContext(context.Background(), projectID)
+}
+
+// ListServiceAccountsContext is ListServiceAccounts with a context that kills gcloud when done
+func ListServiceAccountsContext(ctx context.Context, projectID string) ([]string, error) {
+	cmd := gcloudCommandContext(ctx, "iam", "service-accounts", "list",
 		"--project", projectID,
 		"--format", "value(email)")
-	output, err := cmd.Output()
+	output, err := outputGcloud("list service accounts", cmd)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list service accounts: %v", err)
+		return nil, err
 	}
 	return strings.Split(strings.TrimSpace(string(output)), "\n"), nil
 }
@@ -2,23 +2,50 @@ package main
 
 import (
 	"fmt"
-	"log"
 	"os"
-	"os/exec"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 )
 
 type config struct {
-	projectID             string
-	githubRepositoryOwner string
-	githubRepository      string
-	poolName              string
-	providerName          string
-	showDeleted           bool
-	unsafe                bool
-	serviceAccount        string
+	projectID                 string
+	githubRepositoryOwner     string
+	githubRepository          string
+	githubRepositoryOwnerID   string
+	githubRepositoryID        string
+	poolName                  string
+	providerName              string
+	showDeleted               bool
+	unsafe                    bool
+	orgProvider               bool
+	expires                   string
+	expiresAt                 time.Time
+	serviceAccount            string
+	serviceAccountProjects    []string
+	conditionPresets          []string
+	tokenFile                 string
+	claimsFile                string
+	checkoutDir               string
+	manifestFile              string
+	apply                     bool
+	format                    string
+	reportFormat              string
+	outputFile                string
+	organization              string
+	folder                    string
+	workers                   int
+	projectTimeout            time.Duration
+	fromProject               string
+	toProject                 string
+	diffProjects              []string
+	createServiceAccounts     bool
+	onboardFile               string
+	outputDir                 string
+	skipAPICheck              bool
+	account                   string
+	impersonateServiceAccount string
 }
 
 func main() {
@@ -55,10 +82,19 @@ gwif --project my-project pools create
 gwif --project my-project providers create
 gwif --project my-project auth
 gwif --project my-project yaml
+
+Every gcloud call is made with --project (and --account / --impersonate-service-account
+when set), so the active gcloud configuration does not need to match the target project.
 `,
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			configureGcloud(cfg)
+		},
 	}
 
 	rootCmd.PersistentFlags().StringVar(&cfg.projectID, "project", "", "Google Cloud project ID")
+	rootCmd.PersistentFlags().StringVar(&cfg.account, "account", "", "Google Cloud account to run gcloud as (defaults to the active gcloud account)")
+	rootCmd.PersistentFlags().StringVar(&cfg.impersonateServiceAccount, "impersonate-service-account", "", "Service account to impersonate for all gcloud calls")
+	rootCmd.PersistentFlags().BoolVar(&cfg.skipAPICheck, "skip-api-check", false, "Skip checking that the required Google APIs are enabled")
 
 	// ========================= Pools =========================
 	poolsCmd := &cobra.Command{
@@ -70,10 +106,13 @@ gwif --project my-project yaml
 		Use:   "create",
 		Short: "Create a Workload Identity pool",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if err := AssistConfigForPoolCreate(cfg); err != nil {
+			if err := AssistConfigForRoot(cfg); err != nil {
 				return err
 			}
-			if err := verifyActiveProject(cfg.projectID); err != nil {
+			if err := EnsureRequiredServices(cfg); err != nil {
+				return err
+			}
+			if err := AssistConfigForPoolCreate(cfg); err != nil {
 				return err
 			}
 			return CreatePool(cfg)
@@ -126,12 +165,17 @@ gwif --project my-project yaml
 				return err
 			}
 
-			return DeletePool(cfg)
+			projectNumber, err := getProjectNumber(cfg.projectID)
+			if err != nil {
+				return err
+			}
+			return DeletePool(cfg, projectNumber)
 		},
 	}
 
 	poolsCmd.PersistentFlags().StringVar(&cfg.poolName, "pool", "", "Workload Identity pool name")
 	listPoolsCmd.Flags().BoolVar(&cfg.showDeleted, "deleted", false, "Show deleted pools")
+	deletePoolCmd.Flags().StringSliceVar(&cfg.serviceAccountProjects, "service-account-project", nil, "Also scan service accounts in this project for bindings to the pool (repeatable)")
 
 	poolsCmd.AddCommand(createPoolCmd)
 	poolsCmd.AddCommand(listPoolsCmd)
@@ -148,10 +192,13 @@ gwif --project my-project yaml
 		Use:   "create",
 		Short: "Create a Workload Identity provider",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if err := AssistConfigForProviderCreate(cfg); err != nil {
+			if err := AssistConfigForRoot(cfg); err != nil {
 				return err
 			}
-			if err := verifyActiveProject(cfg.projectID); err != nil {
+			if err := EnsureRequiredServices(cfg); err != nil {
+				return err
+			}
+			if err := AssistConfigForProviderCreate(cfg); err != nil {
 				return err
 			}
 
@@ -160,6 +207,9 @@ gwif --project my-project yaml
 				return err
 			}
 
+			if cfg.orgProvider {
+				return CreateProvider(cfg, projectNumber, "")
+			}
 			githubRepositoryFullName := fmt.Sprintf("%s/%s", cfg.githubRepositoryOwner, cfg.githubRepository)
 			return CreateProvider(cfg, projectNumber, githubRepositoryFullName)
 		},
@@ -172,9 +222,6 @@ gwif --project my-project yaml
 			if err := AssistConfigForProviderSubcommand(cfg); err != nil {
 				return err
 			}
-			if err := verifyActiveProject(cfg.projectID); err != nil {
-				return err
-			}
 			providers, err := ListProviders(cfg.projectID, cfg.poolName, cfg.showDeleted)
 			if err != nil {
 				return err
@@ -204,6 +251,17 @@ gwif --project my-project yaml
 		},
 	}
 
+	describeProviderCmd := &cobra.Command{
+		Use:   "describe",
+		Short: "Describe a Workload Identity provider",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := AssistConfigForProviderDescribe(cfg); err != nil {
+				return err
+			}
+			return DescribeProvider(cfg)
+		},
+	}
+
 	deleteProviderCmd := &cobra.Command{
 		Use:   "delete",
 		Short: "Delete a Workload Identity provider",
@@ -211,10 +269,11 @@ gwif --project my-project yaml
 			if err := AssistConfigForProviderDelete(cfg); err != nil {
 				return err
 			}
-			if err := verifyActiveProject(cfg.projectID); err != nil {
+			projectNumber, err := getProjectNumber(cfg.projectID)
+			if err != nil {
 				return err
 			}
-			return DeleteProvider(cfg)
+			return DeleteProvider(cfg, projectNumber)
 		},
 	}
 
@@ -225,25 +284,29 @@ gwif --project my-project yaml
 			if err := AssistConfigForProviderRestore(cfg); err != nil {
 				return err
 			}
-			if err := verifyActiveProject(cfg.projectID); err != nil {
-				return err
-			}
 			return RestoreProvider(cfg)
 		},
 	}
 	providersCmd.PersistentFlags().StringVar(&cfg.poolName, "pool", "", "Workload Identity pool name")
 
 	createProviderCmd.Flags().BoolVar(&cfg.unsafe, "unsafe", false, "Allow unsafe configurations (allows repository name condition to not be enforced in the provider)")
+	createProviderCmd.Flags().BoolVar(&cfg.orgProvider, "org", false, "Create an org provider admitting every repository of the owner, service accounts must then be bound by repository")
 	createProviderCmd.Flags().StringVar(&cfg.providerName, "provider", "", "Workload Identity provider name")
 	createProviderCmd.Flags().StringVar(&cfg.githubRepositoryOwner, "owner", "", "GitHub repository owner (case sensitive)")
 	createProviderCmd.Flags().StringVar(&cfg.githubRepository, "repo", "", "GitHub repository name (case sensitive)")
+	createProviderCmd.Flags().StringSliceVar(&cfg.conditionPresets, "preset", nil, "Condition presets to apply ("+strings.Join(conditionPresetNames(), ", ")+"), values as name=a|b e.g. protected-environments=staging|prod")
+	createProviderCmd.Flags().StringVar(&cfg.githubRepositoryOwnerID, "owner-id", "", "GitHub repository owner numeric ID (looked up from the GitHub API if not set)")
+	createProviderCmd.Flags().StringVar(&cfg.githubRepositoryID, "repo-id", "", "GitHub repository numeric ID (looked up from the GitHub API if not set)")
 
 	listProvidersCmd.Flags().BoolVar(&cfg.showDeleted, "deleted", false, "Show deleted providers")
+	describeProviderCmd.Flags().StringVar(&cfg.providerName, "provider", "", "Workload Identity provider name")
 	deleteProviderCmd.Flags().StringVar(&cfg.providerName, "provider", "", "Workload Identity provider name")
+	deleteProviderCmd.Flags().StringSliceVar(&cfg.serviceAccountProjects, "service-account-project", nil, "Also scan service accounts in this project for bindings to the pool (repeatable)")
 	restoreProviderCmd.Flags().StringVar(&cfg.providerName, "provider", "", "Workload Identity provider name")
 
 	providersCmd.AddCommand(createProviderCmd)
 	providersCmd.AddCommand(listProvidersCmd)
+	providersCmd.AddCommand(describeProviderCmd)
 	providersCmd.AddCommand(deleteProviderCmd)
 	providersCmd.AddCommand(restoreProviderCmd)
 	rootCmd.AddCommand(providersCmd)
@@ -252,13 +315,33 @@ gwif --project my-project yaml
 	authCmd := &cobra.Command{
 		Use:   "auth",
 		Short: "Configure service account authentication",
+		// Without this a mistyped subcommand would start the interactive binding flow
+		Args: cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if err := AssistConfigForAuth(cfg); err != nil {
+			if cfg.expires != "" {
+				expiresAt, err := parseExpiry(cfg.expires, time.Now())
+				if err != nil {
+					return err
+				}
+				cfg.expiresAt = expiresAt
+			}
+			if err := AssistConfigForRoot(cfg); err != nil {
+				return err
+			}
+			if err := EnsureRequiredServices(cfg); err != nil {
 				return err
 			}
-			if err := verifyActiveProject(cfg.projectID); err != nil {
+			if err := AssistConfigForAuth(cfg); err != nil {
 				return err
 			}
+			// The IAM Credentials API issues the tokens in the service account's project
+			if accountProject := serviceAccountProjectID(cfg); accountProject != cfg.projectID {
+				accountCfg := *cfg
+				accountCfg.projectID = accountProject
+				if err := EnsureRequiredServices(&accountCfg); err != nil {
+					return err
+				}
+			}
 
 			projectNumber, err := getProjectNumber(cfg.projectID)
 			if err != nil {
@@ -276,9 +359,43 @@ gwif --project my-project yaml
 		},
 	}
 	authCmd.Flags().StringVar(&cfg.serviceAccount, "service-account", "", "Service account email address")
+	authCmd.Flags().StringSliceVar(&cfg.serviceAccountProjects, "service-account-project", nil, "Also offer the service accounts in this project (repeatable)")
 	authCmd.Flags().StringVar(&cfg.poolName, "pool", "", "Workload Identity pool name")
 	authCmd.Flags().StringVar(&cfg.providerName, "provider", "", "Workload Identity provider name")
+	authCmd.Flags().StringVar(&cfg.expires, "expires", "", "Let the binding expire after a duration (e.g. 8h, 7d) or at a timestamp (e.g. 2026-01-31T18:00:00Z)")
+
+	listAuthCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List workload identity bindings on service accounts and their remaining validity",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := AssistConfigForRoot(cfg); err != nil {
+				return err
+			}
+			return ListAuthBindings(bindingProjects(cfg)...)
+		},
+	}
+
+	pruneExpiredAuthCmd := &cobra.Command{
+		Use:   "prune-expired",
+		Short: "Remove time-limited bindings that have expired",
+		Long: `Removes the service account bindings added with gwif auth --expires whose expiry has passed.
+Expired bindings no longer grant access, pruning keeps the IAM policies readable.
+
+Example:
+gwif auth prune-expired --project my-project
+`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := AssistConfigForRoot(cfg); err != nil {
+				return err
+			}
+			return PruneExpiredBindings(bindingProjects(cfg)...)
+		},
+	}
+	listAuthCmd.Flags().StringSliceVar(&cfg.serviceAccountProjects, "service-account-project", nil, "Also scan service accounts in this project for bindings (repeatable)")
+	pruneExpiredAuthCmd.Flags().StringSliceVar(&cfg.serviceAccountProjects, "service-account-project", nil, "Also scan service accounts in this project for bindings (repeatable)")
 
+	authCmd.AddCommand(listAuthCmd)
+	authCmd.AddCommand(pruneExpiredAuthCmd)
 	rootCmd.AddCommand(authCmd)
 
 	// ========================= YAML =========================
@@ -303,33 +420,403 @@ gwif --project my-project yaml
 	yamlCmd.Flags().StringVar(&cfg.poolName, "pool", "", "Workload Identity pool name")
 	yamlCmd.Flags().StringVar(&cfg.providerName, "provider", "", "Workload Identity provider name")
 	yamlCmd.Flags().StringVar(&cfg.serviceAccount, "service-account", "", "Service account email address")
+	yamlCmd.Flags().StringSliceVar(&cfg.serviceAccountProjects, "service-account-project", nil, "Also offer the service accounts in this project (repeatable)")
 	rootCmd.AddCommand(yamlCmd)
 
-	if err := rootCmd.Execute(); err != nil {
-		log.Println(err)
-		os.Exit(1)
+	// ========================= Doctor =========================
+	doctorCmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check that gcloud, the project and your permissions are ready for gwif",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if cfg.projectID == "" {
+				return fmt.Errorf("--project is required, e.g. gwif doctor --project my-project")
+			}
+			return Doctor(cfg)
+		},
 	}
-}
+	rootCmd.AddCommand(doctorCmd)
 
-func verifyActiveProject(projectID string) error {
-	cmd := exec.Command("gcloud", "config", "get-value", "project")
-	output, err := cmd.Output()
-	if err != nil {
-		return fmt.Errorf("failed to get current project: %v", err)
+	// ========================= Status =========================
+	statusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show which service accounts a repository can reach and with which roles",
+		Long: `Finds the providers whose condition admits the repository, the service account bindings
+its tokens can match and the project roles of those service accounts, and prints the workflow
+configuration for each chain.
+
+Only the repository is known ahead of a token, so providers and bindings that depend on other
+claims (like the ref or the workflow) are shown with what they depend on. Workflows and
+environments are looked up from the GitHub API to narrow down those bindings.
+
+Example:
+gwif status --project my-project --owner my-org --repo my-repo
+`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := AssistConfigForRoot(cfg); err != nil {
+				return err
+			}
+			if err := AssistGithubForStatus(cfg); err != nil {
+				return err
+			}
+
+			projectNumber, err := getProjectNumber(cfg.projectID)
+			if err != nil {
+				return err
+			}
+			return Status(cfg, projectNumber)
+		},
+	}
+	statusCmd.Flags().StringVar(&cfg.githubRepositoryOwner, "owner", "", "GitHub repository owner (case sensitive)")
+	statusCmd.Flags().StringVar(&cfg.githubRepository, "repo", "", "GitHub repository name (case sensitive)")
+	statusCmd.Flags().StringVar(&cfg.githubRepositoryOwnerID, "owner-id", "", "GitHub repository owner numeric ID (looked up from the GitHub API if not set)")
+	statusCmd.Flags().StringVar(&cfg.githubRepositoryID, "repo-id", "", "GitHub repository numeric ID (looked up from the GitHub API if not set)")
+	statusCmd.Flags().StringSliceVar(&cfg.serviceAccountProjects, "service-account-project", nil, "Also scan service accounts in this project for bindings to the project's pools (repeatable)")
+	rootCmd.AddCommand(statusCmd)
+
+	// ========================= Graph =========================
+	graphCmd := &cobra.Command{
+		Use:   "graph",
+		Short: "Render the pools, providers, bindings and service accounts of a project as a graph",
+		Long: `Renders who can reach what: pools, their providers with the attribute conditions,
+the principalSet bindings from pools to service accounts and the roles of those service accounts
+in their own project. Service accounts whose project policy can't be read are marked as roles not
+scanned. Paste the output into a Mermaid block or render it with Graphviz.
+
+Example:
+gwif graph --project my-project > trust.mmd
+gwif graph --project my-project --format dot | dot -Tsvg > trust.svg
+`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// The project menu would end up in the redirected graph
+			if cfg.projectID == "" && !stdoutIsTerminal() {
+				return fmt.Errorf("--project is required when the graph is redirected")
+			}
+			if err := AssistConfigForRoot(cfg); err != nil {
+				return err
+			}
+
+			projectNumber, err := getProjectNumber(cfg.projectID)
+			if err != nil {
+				return err
+			}
+			return Graph(cfg, projectNumber)
+		},
 	}
+	graphCmd.Flags().StringVar(&cfg.format, "format", "mermaid", "Output format: mermaid or dot")
+	graphCmd.Flags().StringSliceVar(&cfg.serviceAccountProjects, "service-account-project", nil, "Also scan service accounts in this project for bindings to the project's pools (repeatable)")
+	rootCmd.AddCommand(graphCmd)
+
+	// ========================= Inventory =========================
+	inventoryCmd := &cobra.Command{
+		Use:   "inventory",
+		Short: "Report pools, providers, conditions and bindings across many projects",
+		Long: `Walks every project you can see, or the projects in an organization or folder (including
+nested folders), and collects pools, providers with their conditions and the workload identity
+bindings on service accounts into one JSON or CSV report.
 
-	currentProject := strings.TrimSpace(string(output))
-	if currentProject != projectID {
-		return fmt.Errorf("gcloud is not currently configured to %s", projectID)
+Projects are walked concurrently. A project that fails or times out is reported with its error
+instead of failing the whole inventory, projects with the IAM API disabled are marked as skipped.
+
+Example:
+gwif inventory --organization 123456789 --format csv --output inventory.csv
+gwif inventory --folder 987654321 --workers 16
+`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return Inventory(cfg)
+		},
+	}
+	inventoryCmd.Flags().StringVar(&cfg.organization, "organization", "", "Organization ID to walk")
+	inventoryCmd.Flags().StringVar(&cfg.folder, "folder", "", "Folder ID to walk")
+	inventoryCmd.Flags().StringVar(&cfg.reportFormat, "format", "json", "Report format: json or csv")
+	inventoryCmd.Flags().StringVarP(&cfg.outputFile, "output", "o", "", "File to write the report to (default stdout)")
+	inventoryCmd.Flags().IntVar(&cfg.workers, "workers", 8, "Number of projects collected concurrently")
+	inventoryCmd.Flags().DurationVar(&cfg.projectTimeout, "timeout", 2*time.Minute, "Time limit for collecting a single project")
+	rootCmd.AddCommand(inventoryCmd)
+
+	// ========================= Export =========================
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export a pool, its providers and service account bindings",
+	}
+	exportCmd.PersistentFlags().StringVar(&cfg.poolName, "pool", "", "Workload Identity pool name")
+	exportCmd.PersistentFlags().StringVarP(&cfg.outputFile, "output", "o", "", "File to write the export to (default stdout)")
+	exportCmd.PersistentFlags().StringSliceVar(&cfg.serviceAccountProjects, "service-account-project", nil, "Also scan service accounts in this project for bindings to the pool (repeatable)")
+	rootCmd.AddCommand(exportCmd)
+
+	exportTerraformCmd := &cobra.Command{
+		Use:   "terraform",
+		Short: "Export as Terraform resources with import blocks",
+		Long: `Exports the pool, its providers (with the exact attribute mapping and condition) and the
+service account bindings referencing the pool as Terraform resources. Import blocks for every
+resource let Terraform adopt the live resources without recreating them (Terraform 1.5+).
+
+Example:
+gwif export terraform --project my-project --pool github-actions-pool -o wif.tf
+`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := AssistConfigForExport(cfg); err != nil {
+				return err
+			}
+
+			projectNumber, err := getProjectNumber(cfg.projectID)
+			if err != nil {
+				return err
+			}
+			return Export(cfg, projectNumber, RenderTerraform)
+		},
+	}
+	exportCmd.AddCommand(exportTerraformCmd)
+
+	exportScriptCmd := &cobra.Command{
+		Use:   "script",
+		Short: "Export as an idempotent shell script of gcloud commands",
+		Long: `Exports the pool, its providers and the service account bindings referencing the pool as a
+commented bash script of the gcloud commands gwif runs. Pools and providers are only created when
+describing them fails, so the script can be reviewed and run repeatedly without gwif.
+
+Example:
+gwif export script --project my-project --pool github-actions-pool -o wif.sh
+`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := AssistConfigForExport(cfg); err != nil {
+				return err
+			}
+
+			projectNumber, err := getProjectNumber(cfg.projectID)
+			if err != nil {
+				return err
+			}
+			return Export(cfg, projectNumber, RenderScript)
+		},
+	}
+	exportCmd.AddCommand(exportScriptCmd)
+
+	exportConfigConnectorCmd := &cobra.Command{
+		Use:     "config-connector",
+		Aliases: []string{"kcc"},
+		Short:   "Export as Config Connector manifests",
+		Long: `Exports the pool, its providers and the service account bindings referencing the pool as
+IAMWorkloadIdentityPool, IAMWorkloadIdentityPoolProvider and IAMPolicyMember manifests.
+Config Connector acquires the existing resources when the manifests are applied.
+
+Example:
+gwif export config-connector --project my-project --pool github-actions-pool -o wif.yaml
+`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := AssistConfigForExport(cfg); err != nil {
+				return err
+			}
+
+			projectNumber, err := getProjectNumber(cfg.projectID)
+			if err != nil {
+				return err
+			}
+			return Export(cfg, projectNumber, RenderConfigConnector)
+		},
+	}
+	exportCmd.AddCommand(exportConfigConnectorCmd)
+
+	// ========================= Copy =========================
+	copyCmd := &cobra.Command{
+		Use:   "copy",
+		Short: "Copy a pool, its providers and service account bindings to another project",
+		Long: `Reads the pool, its providers and the service account bindings referencing the pool in the
+source project and recreates them in the destination project after showing the plan.
+
+Service accounts are mapped by name (deploy@staging.iam.gserviceaccount.com becomes
+deploy@prod.iam.gserviceaccount.com), and project numbers in the attribute mapping audience and
+the principalSet members are rewritten for the destination. Existing pools and providers are kept.
+
+Example:
+gwif copy --from-project my-staging --to-project my-prod --pool github-actions-pool
+`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := AssistConfigForCopy(cfg); err != nil {
+				return err
+			}
+
+			destination := *cfg
+			destination.projectID = cfg.toProject
+			if err := EnsureRequiredServices(&destination); err != nil {
+				return err
+			}
+			return CopySetup(cfg)
+		},
+	}
+	copyCmd.Flags().StringVar(&cfg.fromProject, "from-project", "", "Project to copy from")
+	copyCmd.Flags().StringVar(&cfg.toProject, "to-project", "", "Project to copy to")
+	copyCmd.Flags().StringVar(&cfg.poolName, "pool", "", "Workload Identity pool name")
+	copyCmd.Flags().BoolVar(&cfg.createServiceAccounts, "create-service-accounts", false, "Create service accounts missing in the destination project")
+	copyCmd.Flags().StringSliceVar(&cfg.serviceAccountProjects, "service-account-project", nil, "Also scan service accounts in this project of the source for bindings to the pool (repeatable)")
+	rootCmd.AddCommand(copyCmd)
+
+	// ========================= Onboard =========================
+	onboardCmd := &cobra.Command{
+		Use:   "onboard",
+		Short: "Create providers and service account bindings for many repositories from a CSV or YAML file",
+		Long: `Onboards every repository listed in a CSV or YAML file: creates its provider (pinned by the numeric
+owner and repository IDs when GitHub resolves them), creates the service account when asked to,
+binds it, and writes the workflow steps of each repository to the output directory.
+
+Columns: owner,repo,provider,conditions,service_account,create_service_account,attribute,value
+- provider defaults to owner-repo, an existing provider is reused only when its condition admits the
+  repository and requires the row's conditions
+- conditions are condition presets separated by ;, e.g. main-only;protected-environments=staging|prod
+- service_account is an email or a name in the project
+- attribute and value default to repository_id and owner/repo
+
+Files ending in .yaml or .yml hold a list of repositories with the column names as keys and the
+conditions as a list, e.g.
+- owner: my-org
+  repo: api
+  conditions: [main-only, protected-environments=staging|prod]
+  service_account: deploy
+
+Rows that fail don't stop the others, a summary table shows the outcome of every row.
+
+Example:
+gwif onboard --project my-project --pool github-actions-pool -f repos.csv
+gwif onboard --project my-project --pool github-actions-pool -f repos.yaml
+`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if cfg.onboardFile == "" {
+				return fmt.Errorf("an onboarding file is required, e.g. -f repos.csv")
+			}
+			if err := AssistConfigForRoot(cfg); err != nil {
+				return err
+			}
+			if err := EnsureRequiredServices(cfg); err != nil {
+				return err
+			}
+			if err := AssistConfigForOnboard(cfg); err != nil {
+				return err
+			}
+
+			projectNumber, err := getProjectNumber(cfg.projectID)
+			if err != nil {
+				return err
+			}
+			// Failed rows are reported in the summary, not a usage error
+			cmd.SilenceUsage = true
+			return Onboard(cfg, projectNumber)
+		},
+	}
+	onboardCmd.Flags().StringVarP(&cfg.onboardFile, "file", "f", "", "CSV or YAML file listing the repositories to onboard")
+	onboardCmd.Flags().StringVar(&cfg.poolName, "pool", "", "Workload Identity pool name")
+	onboardCmd.Flags().StringVar(&cfg.outputDir, "output-dir", "gwif-onboard", "Directory the workflow YAML of each repository is written to")
+	rootCmd.AddCommand(onboardCmd)
+
+	// ========================= Diff =========================
+	diffCmd := &cobra.Command{
+		Use:   "diff",
+		Short: "Compare the workload identity configuration of two projects",
+		Long: `Compares pools (display names, descriptions, disabled state), providers (conditions, attribute
+mappings, issuers and audiences) and the workload identity bindings on service accounts of two
+projects. Project numbers and IDs in audiences, principalSet members and service account emails
+are normalized, so only real differences show. Only service accounts in the two projects are
+compared, bindings on service accounts in other projects are not covered.
+
+Exits with an error when the projects differ.
+
+Example:
+gwif diff --project my-staging --project my-prod
+`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(cfg.diffProjects) != 2 {
+				return fmt.Errorf("--project must be given exactly twice, e.g. --project my-staging --project my-prod")
+			}
+			// Differing projects are an expected outcome, not a usage error
+			cmd.SilenceUsage = true
+			return DiffProjects(cfg.diffProjects[0], cfg.diffProjects[1])
+		},
+	}
+	diffCmd.Flags().StringArrayVar(&cfg.diffProjects, "project", nil, "Project to compare, given twice")
+	rootCmd.AddCommand(diffCmd)
+
+	// ========================= GC =========================
+	gcCmd := &cobra.Command{
+		Use:   "gc",
+		Short: "Find and remove orphaned service account bindings",
+		Long: `Scans the IAM policies of all service accounts in the project for workload identity
+bindings that reference deleted or non-existent pools. With --checkout or --manifest, bindings
+on attribute.workflow that name a workflow which no longer exists are reported too - only use
+these with the workflows of the repositories the pool serves. Bindings on repo_workflow and
+job_workflow are checked when they name the checked-out repository, taken from --owner and
+--repo or the origin remote of the checkout.
+
+Reports by default, pass --apply to remove the orphaned bindings after confirmation.
+
+Example:
+gwif gc --project my-project
+gwif gc --project my-project --checkout ../my-repo --apply
+`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := AssistConfigForRoot(cfg); err != nil {
+				return err
+			}
+
+			projectNumber, err := getProjectNumber(cfg.projectID)
+			if err != nil {
+				return err
+			}
+			return GarbageCollect(cfg, projectNumber)
+		},
+	}
+	gcCmd.Flags().BoolVar(&cfg.apply, "apply", false, "Remove orphaned bindings (after confirmation) instead of only reporting them")
+	gcCmd.Flags().StringVar(&cfg.checkoutDir, "checkout", "", "Local repository checkout whose .github/workflows lists the existing workflows")
+	gcCmd.Flags().StringVar(&cfg.manifestFile, "manifest", "", "File listing existing workflow names, one per line")
+	gcCmd.Flags().StringVar(&cfg.githubRepositoryOwner, "owner", "", "GitHub owner of the checked-out repository (defaults to the origin remote of --checkout)")
+	gcCmd.Flags().StringVar(&cfg.githubRepository, "repo", "", "Name of the checked-out repository (defaults to the origin remote of --checkout)")
+	gcCmd.Flags().StringSliceVar(&cfg.serviceAccountProjects, "service-account-project", nil, "Also scan service accounts in this project for bindings to the project's pools (repeatable)")
+	rootCmd.AddCommand(gcCmd)
+
+	// ========================= Simulate =========================
+	simulateCmd := &cobra.Command{
+		Use:   "simulate",
+		Short: "Evaluate a GitHub OIDC token against a provider locally",
+		Long: `Decodes a GitHub Actions OIDC token (or its claims as JSON) and evaluates the provider's
+attribute mapping and attribute condition locally, showing the mapped google.subject and
+attribute values, whether the condition admits the token, and which service account
+bindings would match. The token signature is not verified.
+
+Example:
+gwif simulate --pool github-actions-pool --provider github-provider --token token.jwt
+gwif simulate --pool github-actions-pool --provider github-provider --claims claims.json
+`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			claims, err := LoadTokenClaims(cfg.tokenFile, cfg.claimsFile)
+			if err != nil {
+				return err
+			}
+			if err := AssistConfigForProviderDescribe(cfg); err != nil {
+				return err
+			}
+
+			projectNumber, err := getProjectNumber(cfg.projectID)
+			if err != nil {
+				return err
+			}
+			return Simulate(cfg, projectNumber, claims)
+		},
+	}
+	simulateCmd.Flags().StringVar(&cfg.tokenFile, "token", "", "File containing a GitHub OIDC token (JWT)")
+	simulateCmd.Flags().StringVar(&cfg.claimsFile, "claims", "", "File containing the token claims as JSON")
+	simulateCmd.Flags().StringVar(&cfg.poolName, "pool", "", "Workload Identity pool name")
+	simulateCmd.Flags().StringVar(&cfg.providerName, "provider", "", "Workload Identity provider name")
+	simulateCmd.Flags().StringSliceVar(&cfg.serviceAccountProjects, "service-account-project", nil, "Also scan service accounts in this project for bindings to the pool (repeatable)")
+	rootCmd.AddCommand(simulateCmd)
+
+	if err := rootCmd.Execute(); err != nil {
+		printError(err)
+		os.Exit(1)
 	}
-	return nil
 }
 
 func getProjectNumber(projectID string) (string, error) {
-	cmd := exec.Command("gcloud", "projects", "describe", projectID, "--format=value(projectNumber)")
-	output, err := cmd.Output()
+	cmd := gcloudCommand("projects", "describe", projectID, "--format=value(projectNumber)")
+	output, err := outputGcloud("get project number", cmd)
 	if err != nil {
-		return "", fmt.Errorf("failed to get project number: %v", err)
+		return "", err
 	}
 	return strings.TrimSpace(string(output)), nil
 }
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ValidateResourceID checks a pool or provider ID against Google's rules:
+// 4-32 lowercase letters, digits and hyphens, no leading or trailing hyphen and no reserved gcp- prefix
+func ValidateResourceID(kind, id string) error {
+	switch {
+	case len(id) < 4 || len(id) > 32:
+		return fmt.Errorf("invalid %s name %q: must be 4-32 characters long, got %d", kind, id, len(id))
+	case strings.ContainsFunc(id, func(r rune) bool {
+		return !strings.ContainsRune("abcdefghijklmnopqrstuvwxyz0123456789-", r)
+	}):
+		return fmt.Errorf("invalid %s name %q: only lowercase letters, numbers and hyphens are allowed", kind, id)
+	case strings.HasPrefix(id, "-") || strings.HasSuffix(id, "-"):
+		return fmt.Errorf("invalid %s name %q: must not start or end with a hyphen", kind, id)
+	case strings.HasPrefix(id, "gcp-"):
+		return fmt.Errorf("invalid %s name %q: the gcp- prefix is reserved by Google", kind, id)
+	}
+	return nil
+}
+
+// checkDeletedNameCollision returns an error suggesting alternatives when id is held by a soft-deleted resource,
+// which blocks reusing the name for 30 days
+func checkDeletedNameCollision(kind, id string, active, deleted []string) error {
+	if !slices.Contains(deleted, id) {
+		return nil
+	}
+	msg := fmt.Sprintf("%s name %q is held by a deleted %s for up to 30 days after deletion", kind, id, kind)
+	if suggestions := suggestResourceIDs(id, slices.Concat(active, deleted)); len(suggestions) > 0 {
+		msg += fmt.Sprintf(" - try %s", strings.Join(suggestions, ", "))
+	}
+	return fmt.Errorf("%s", msg)
+}
+
+// suggestResourceIDs returns up to three valid IDs derived from id that aren't taken
+func suggestResourceIDs(id string, taken []string) []string {
+	var suggestions []string
+	for i := 2; i < 100 && len(suggestions) < 3; i++ {
+		suffix := fmt.Sprintf("-%d", i)
+		base := id
+		if len(base)+len(suffix) > 32 {
+			base = strings.TrimRight(base[:32-len(suffix)], "-")
+		}
+		candidate := base + suffix
+		if ValidateResourceID("", candidate) == nil && !slices.Contains(taken, candidate) {
+			suggestions = append(suggestions, candidate)
+		}
+	}
+	return suggestions
+}
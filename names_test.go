@@ -0,0 +1,72 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateResourceID(t *testing.T) {
+	tests := []struct {
+		id   string
+		want string
+	}{
+		{"abcd", ""},
+		{"github-actions-pool", ""},
+		{"pool-2", ""},
+		{"1234", ""},
+		{strings.Repeat("a", 32), ""},
+		{"gcpx", ""},
+
+		{"abc", "must be 4-32 characters long, got 3"},
+		{"", "must be 4-32 characters long, got 0"},
+		{strings.Repeat("a", 33), "must be 4-32 characters long, got 33"},
+		{"GitHub-pool", "only lowercase letters, numbers and hyphens"},
+		{"github_pool", "only lowercase letters, numbers and hyphens"},
+		{"github.pool", "only lowercase letters, numbers and hyphens"},
+		{"pööl", "only lowercase letters, numbers and hyphens"},
+		{"-pool", "must not start or end with a hyphen"},
+		{"pool-", "must not start or end with a hyphen"},
+		{"gcp-pool", "the gcp- prefix is reserved"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			err := ValidateResourceID("pool", tt.id)
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("ValidateResourceID(%q) failed: %v", tt.id, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ValidateResourceID(%q) error = %v, want %q", tt.id, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSuggestResourceIDs(t *testing.T) {
+	tests := []struct {
+		id    string
+		taken []string
+		want  []string
+	}{
+		{"github-pool", nil, []string{"github-pool-2", "github-pool-3", "github-pool-4"}},
+		{"github-pool", []string{"github-pool-2", "github-pool-4"}, []string{"github-pool-3", "github-pool-5", "github-pool-6"}},
+		// Suggestions stay within 32 characters, without a hyphen before the suffix doubling up
+		{strings.Repeat("a", 32), nil, []string{strings.Repeat("a", 30) + "-2", strings.Repeat("a", 30) + "-3", strings.Repeat("a", 30) + "-4"}},
+		{strings.Repeat("a", 29) + "-bc", nil, []string{strings.Repeat("a", 29) + "-2", strings.Repeat("a", 29) + "-3", strings.Repeat("a", 29) + "-4"}},
+		{strings.Repeat("a", 31) + "b", nil, []string{strings.Repeat("a", 30) + "-2", strings.Repeat("a", 30) + "-3", strings.Repeat("a", 30) + "-4"}},
+	}
+	for _, tt := range tests {
+		got := suggestResourceIDs(tt.id, tt.taken)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("suggestResourceIDs(%q, %v) = %v, want %v", tt.id, tt.taken, got, tt.want)
+		}
+		for _, id := range got {
+			if err := ValidateResourceID("pool", id); err != nil {
+				t.Errorf("suggestResourceIDs(%q) suggests an invalid ID: %v", tt.id, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,449 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+// onboardColumns are the columns of an onboarding file, in the order of its header
+var onboardColumns = []string{"owner", "repo", "provider", "conditions", "service_account", "create_service_account", "attribute", "value"}
+
+// onboardRow is one repository to onboard
+type onboardRow struct {
+	line                 int
+	owner                string
+	repo                 string
+	provider             string
+	conditions           []string
+	serviceAccount       string
+	createServiceAccount bool
+	attribute            string
+	value                string
+}
+
+// onboardResult is the outcome of onboarding a row, shown in the summary table
+type onboardResult struct {
+	row      onboardRow
+	provider string
+	binding  string
+	yamlFile string
+	err      error
+}
+
+// Onboard creates a provider and service account binding for every repository in the onboarding file.
+// Rows that fail are reported in the summary and don't stop the remaining rows.
+func Onboard(cfg *config, projectNumber string) error {
+	rows, err := readOnboardFile(cfg.onboardFile)
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return fmt.Errorf("no repositories found in %s", cfg.onboardFile)
+	}
+	if err := os.MkdirAll(cfg.outputDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create output directory: %v", err)
+	}
+
+	providers, err := ListProviders(cfg.projectID, cfg.poolName, false)
+	if err != nil {
+		return err
+	}
+	deleted, err := ListProviders(cfg.projectID, cfg.poolName, true)
+	if err != nil {
+		return err
+	}
+	accounts, err := ListServiceAccounts(cfg.projectID)
+	if err != nil {
+		return err
+	}
+
+	client := NewGitHubClient()
+	results := make([]onboardResult, 0, len(rows))
+	for _, row := range rows {
+		fmt.Printf("\nOnboarding %s/%s (line %d)\n", row.owner, row.repo, row.line)
+		result := onboardRepository(cfg, projectNumber, row, client, &providers, deleted, &accounts)
+		if result.err != nil {
+			fmt.Printf("ERROR: %v\n", result.err)
+		}
+		results = append(results, result)
+	}
+
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "LINE\tREPOSITORY\tPROVIDER\tBINDING\tYAML\tSTATUS")
+	failed := 0
+	for _, r := range results {
+		status := "ok"
+		if r.err != nil {
+			status = "FAILED: " + r.err.Error()
+			failed++
+		}
+		fmt.Fprintf(w, "%d\t%s/%s\t%s\t%s\t%s\t%s\n", r.row.line, r.row.owner, r.row.repo,
+			orDash(r.provider), orDash(r.binding), orDash(r.yamlFile), status)
+	}
+	w.Flush()
+
+	if failed > 0 {
+		return fmt.Errorf("failed to onboard %d of %d repositories", failed, len(results))
+	}
+	return nil
+}
+
+// onboardRepository creates the provider, service account and binding of a row and writes its workflow YAML.
+// providers and accounts are updated with the resources it creates.
+func onboardRepository(cfg *config, projectNumber string, row onboardRow, client GitHubClient, providers *[]string, deleted []string, accounts *[]string) onboardResult {
+	result := onboardResult{row: row}
+
+	providerName := row.provider
+	if providerName == "" {
+		providerName = defaultProviderName(row.owner, row.repo)
+	}
+	if err := ValidateResourceID("provider", providerName); err != nil {
+		result.err = err
+		return result
+	}
+	result.provider = providerName
+
+	ownerID, repoID, err := client.RepositoryIDs(row.owner, row.repo)
+	if err != nil {
+		fmt.Println(err)
+		fmt.Println("WARNING: Without numeric IDs the provider is pinned by name only - set GITHUB_TOKEN for private repositories.")
+		ownerID, repoID = "", ""
+	}
+
+	if slices.Contains(*providers, providerName) {
+		provider, err := GetProvider(cfg.projectID, cfg.poolName, providerName)
+		if err != nil {
+			result.err = err
+			return result
+		}
+		if !admitsRepository(provider.AttributeCondition, row, ownerID, repoID) {
+			result.err = fmt.Errorf("provider %s already exists with a condition that does not admit %s/%s (%s) - set the provider column to another name",
+				providerName, row.owner, row.repo, provider.AttributeCondition)
+			return result
+		}
+		clauses, err := onboardPresetClauses(row)
+		if err != nil {
+			result.err = err
+			return result
+		}
+		if missing := missingConditionClauses(provider.AttributeCondition, clauses); len(missing) > 0 {
+			result.err = fmt.Errorf("provider %s already exists without the row's conditions (%s) - set the provider column to another name or add them to the provider",
+				providerName, strings.Join(missing, " && "))
+			return result
+		}
+		fmt.Printf("Provider %s already exists and admits the repository... reusing\n", providerName)
+	} else {
+		if err := checkDeletedNameCollision("provider", providerName, *providers, deleted); err != nil {
+			result.err = err
+			return result
+		}
+		mappings := providerAttributeMappings(projectNumber, cfg.poolName, providerName)
+		condition, err := onboardCondition(row, ownerID, repoID)
+		if err != nil {
+			result.err = err
+			return result
+		}
+		fmt.Printf("Attribute condition: %s\n", condition)
+		if err := validateProviderExpressions(mappings, condition); err != nil {
+			result.err = err
+			return result
+		}
+		if err := createProvider(cfg.projectID, cfg.poolName, providerName, mappings, condition); err != nil {
+			result.err = err
+			return result
+		}
+		*providers = append(*providers, providerName)
+	}
+
+	serviceAccount := row.serviceAccount
+	if !strings.Contains(serviceAccount, "@") {
+		serviceAccount += "@" + cfg.projectID + ".iam.gserviceaccount.com"
+	}
+	accountProject := serviceAccountEmailProject(serviceAccount, cfg.projectID)
+	if accountProject == cfg.projectID && !slices.Contains(*accounts, serviceAccount) {
+		if !row.createServiceAccount {
+			result.err = fmt.Errorf("service account %s does not exist, set create_service_account to create it", serviceAccount)
+			return result
+		}
+		name, _, _ := strings.Cut(serviceAccount, "@")
+		cmd := gcloudCommand("iam", "service-accounts", "create", name, "--project", cfg.projectID)
+		if err := runGcloud("create service account "+serviceAccount, cmd); err != nil {
+			result.err = err
+			return result
+		}
+		*accounts = append(*accounts, serviceAccount)
+	}
+
+	attribute, value := row.attribute, row.value
+	if attribute == "" {
+		attribute, value = "repository_id", row.owner+"/"+row.repo
+	}
+	if !slices.ContainsFunc(bindingAttributes, func(a bindingAttribute) bool { return a.name == attribute }) {
+		result.err = fmt.Errorf("unknown binding attribute %q", attribute)
+		return result
+	}
+	if value == "" {
+		result.err = fmt.Errorf("a value is required for binding attribute %s", attribute)
+		return result
+	}
+	provider, err := GetProvider(cfg.projectID, cfg.poolName, providerName)
+	if err != nil {
+		result.err = err
+		return result
+	}
+	if err := checkOrgProviderAttribute(provider, attribute); err != nil {
+		result.err = err
+		return result
+	}
+	if _, err := addAttributeBinding(accountProject, serviceAccount, projectNumber, cfg.poolName, attribute, value, nil, client); err != nil {
+		result.err = err
+		return result
+	}
+	result.binding = attribute + "=" + value
+
+	repoCfg := *cfg
+	repoCfg.providerName = providerName
+	repoCfg.serviceAccount = serviceAccount
+	file := filepath.Join(cfg.outputDir, row.owner+"-"+row.repo+".yaml")
+	if err := os.WriteFile(file, []byte(workflowSteps(&repoCfg, projectNumber)), 0o644); err != nil {
+		result.err = fmt.Errorf("failed to write workflow YAML: %v", err)
+		return result
+	}
+	result.yamlFile = file
+	return result
+}
+
+// admitsRepository reports whether an existing provider condition admits the repository of a row:
+// it must pin the owner or repository, and every claim it pins must match the repository
+func admitsRepository(condition string, row onboardRow, ownerID, repoID string) bool {
+	claims := map[string]string{
+		"repository_owner":    row.owner,
+		"repository_owner_id": ownerID,
+		"repository":          row.owner + "/" + row.repo,
+		"repository_id":       repoID,
+	}
+	pins := conditionPins(condition)
+	matched := false
+	for _, pin := range pins {
+		value, ok := claims[pin.claim]
+		if !ok {
+			continue
+		}
+		if value != pin.value {
+			return false
+		}
+		matched = true
+	}
+	return matched
+}
+
+// onboardCondition builds the provider condition of a row, pinned by numeric IDs when they are known
+func onboardCondition(row onboardRow, ownerID, repoID string) (string, error) {
+	ownerCondition, repositoryCondition := repositoryConditions(row.owner, ownerID, row.owner+"/"+row.repo, repoID)
+	clauses, err := onboardPresetClauses(row)
+	if err != nil {
+		return "", err
+	}
+	return celAnd(append([]string{ownerCondition, repositoryCondition}, clauses...)...), nil
+}
+
+// onboardPresetClauses returns the condition clauses of the presets of a row
+func onboardPresetClauses(row onboardRow) ([]string, error) {
+	presets, err := ParseConditionPresets(row.conditions)
+	if err != nil {
+		return nil, err
+	}
+	var clauses []string
+	for _, preset := range presets {
+		// Presets prompt for missing values, which would block a batch run
+		if preset.requiresValues && len(preset.values) == 0 {
+			return nil, fmt.Errorf("the %s preset needs values, e.g. %s=a|b", preset.name, preset.name)
+		}
+		clause, err := preset.Condition()
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, clause)
+	}
+	return clauses, nil
+}
+
+// missingConditionClauses returns the clauses a provider condition doesn't require in a top-level && clause
+func missingConditionClauses(condition string, clauses []string) []string {
+	required := conditionClauses(condition)
+	var missing []string
+	for _, clause := range clauses {
+		for _, c := range conditionClauses(clause) {
+			if !slices.Contains(required, c) {
+				missing = append(missing, c)
+			}
+		}
+	}
+	return missing
+}
+
+// readOnboardFile reads the rows of a CSV file, or of a YAML file when it ends in .yaml or .yml
+func readOnboardFile(path string) ([]onboardRow, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open onboarding file: %v", err)
+	}
+	defer f.Close()
+
+	var rows []onboardRow
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".yaml" || ext == ".yml" {
+		rows, err = readOnboardYAML(f)
+	} else {
+		rows, err = readOnboardCSV(f)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		if row.owner == "" || row.repo == "" || row.serviceAccount == "" {
+			return nil, fmt.Errorf("line %d: owner, repo and service_account are required", row.line)
+		}
+	}
+	return rows, nil
+}
+
+// readOnboardCSV reads rows with the onboardColumns header, conditions are separated by ;
+func readOnboardCSV(f io.Reader) ([]onboardRow, error) {
+	r := csv.NewReader(f)
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read onboarding file header: %v", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !slices.Contains(onboardColumns, name) {
+			return nil, fmt.Errorf("unknown column %q in onboarding file, expected %s", name, strings.Join(onboardColumns, ","))
+		}
+		columns[name] = i
+	}
+	for _, required := range []string{"owner", "repo", "service_account"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("onboarding file is missing the %s column", required)
+		}
+	}
+
+	var rows []onboardRow
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read onboarding file: %v", err)
+		}
+		line, _ := r.FieldPos(0)
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		row := onboardRow{
+			line:           line,
+			owner:          field("owner"),
+			repo:           field("repo"),
+			provider:       field("provider"),
+			serviceAccount: field("service_account"),
+			attribute:      field("attribute"),
+			value:          field("value"),
+		}
+		for _, condition := range strings.Split(field("conditions"), ";") {
+			if condition = strings.TrimSpace(condition); condition != "" {
+				row.conditions = append(row.conditions, condition)
+			}
+		}
+		if create := field("create_service_account"); create != "" {
+			if row.createServiceAccount, err = strconv.ParseBool(create); err != nil {
+				return nil, fmt.Errorf("line %d: invalid create_service_account %q, expected true or false", line, create)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// onboardEntry is a repository in a YAML onboarding file, with the keys of onboardColumns
+type onboardEntry struct {
+	Owner                string   `yaml:"owner"`
+	Repo                 string   `yaml:"repo"`
+	Provider             string   `yaml:"provider"`
+	Conditions           []string `yaml:"conditions"`
+	ServiceAccount       string   `yaml:"service_account"`
+	CreateServiceAccount bool     `yaml:"create_service_account"`
+	Attribute            string   `yaml:"attribute"`
+	Value                string   `yaml:"value"`
+}
+
+// readOnboardYAML reads rows from a YAML list of repositories, conditions are a list of presets
+func readOnboardYAML(f io.Reader) ([]onboardRow, error) {
+	var nodes []yaml.Node
+	if err := yaml.NewDecoder(f).Decode(&nodes); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read onboarding file: %v", err)
+	}
+
+	var rows []onboardRow
+	for _, node := range nodes {
+		if node.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("line %d: expected a repository with the keys %s", node.Line, strings.Join(onboardColumns, ", "))
+		}
+		for i := 0; i < len(node.Content); i += 2 {
+			if key := node.Content[i].Value; !slices.Contains(onboardColumns, key) {
+				return nil, fmt.Errorf("line %d: unknown key %q in onboarding file, expected %s", node.Content[i].Line, key, strings.Join(onboardColumns, ", "))
+			}
+		}
+		var entry onboardEntry
+		if err := node.Decode(&entry); err != nil {
+			return nil, fmt.Errorf("line %d: %v", node.Line, err)
+		}
+		rows = append(rows, onboardRow{
+			line:                 node.Line,
+			owner:                strings.TrimSpace(entry.Owner),
+			repo:                 strings.TrimSpace(entry.Repo),
+			provider:             strings.TrimSpace(entry.Provider),
+			conditions:           entry.Conditions,
+			serviceAccount:       strings.TrimSpace(entry.ServiceAccount),
+			createServiceAccount: entry.CreateServiceAccount,
+			attribute:            strings.TrimSpace(entry.Attribute),
+			value:                strings.TrimSpace(entry.Value),
+		})
+	}
+	return rows, nil
+}
+
+// defaultProviderName derives a provider name from the repository owner and name
+func defaultProviderName(owner, repo string) string {
+	name := strings.Trim(nonKubernetesName.ReplaceAllString(strings.ToLower(owner+"-"+repo), "-"), "-")
+	if len(name) < 4 || strings.HasPrefix(name, "gcp-") {
+		name = "gh-" + name
+	}
+	if len(name) > 32 {
+		name = name[:32]
+	}
+	return strings.TrimRight(name, "-")
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
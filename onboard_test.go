@@ -0,0 +1,121 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAdmitsRepository(t *testing.T) {
+	row := onboardRow{owner: "org-b", repo: "api"}
+	tests := []struct {
+		condition string
+		ownerID   string
+		repoID    string
+		want      bool
+	}{
+		{`assertion.repository_owner=='org-b' && assertion.repository=='org-b/api'`, "", "", true},
+		{`assertion.repository_owner_id=='7' && assertion.repository_id=='42'`, "7", "42", true},
+		{`assertion.repository_owner=='org-b' && assertion.ref=='refs/heads/main'`, "", "", true},
+		{`assertion.repository_owner=='org-b' && assertion.repository=='org-b/api' && assertion.event_name!='pull_request'`, "", "", true},
+
+		{`assertion.repository_owner=='org-a' && assertion.repository=='org-a/api'`, "", "", false},
+		{`assertion.repository_owner_id=='7' && assertion.repository_id=='43'`, "7", "42", false},
+		{`assertion.repository_owner_id=='7' && assertion.repository_id=='42'`, "", "", false},
+		{`assertion.repository_owner=='org-b' || assertion.repository=='org-a/api'`, "", "", false},
+		{`assertion.ref=='refs/heads/main'`, "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.condition, func(t *testing.T) {
+			if got := admitsRepository(tt.condition, row, tt.ownerID, tt.repoID); got != tt.want {
+				t.Errorf("admitsRepository(%q) = %v, want %v", tt.condition, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultProviderName(t *testing.T) {
+	tests := []struct {
+		owner, repo string
+		want        string
+	}{
+		{"org-a", "api", "org-a-api"},
+		{"Org_B", "My.Repo", "org-b-my-repo"},
+		{"gcp", "tools", "gh-gcp-tools"},
+		{"a-very-long-organization", "with-a-long-repository", "a-very-long-organization-with-a"},
+	}
+	for _, tt := range tests {
+		if got := defaultProviderName(tt.owner, tt.repo); got != tt.want {
+			t.Errorf("defaultProviderName(%q, %q) = %q, want %q", tt.owner, tt.repo, got, tt.want)
+		}
+	}
+}
+
+func TestMissingConditionClauses(t *testing.T) {
+	condition := `assertion.repository_owner_id=='7' && assertion.repository_id=='42' && assertion.ref=='refs/heads/main'`
+	tests := []struct {
+		clauses []string
+		want    []string
+	}{
+		{nil, nil},
+		{[]string{`assertion.ref == 'refs/heads/main'`}, nil},
+		{[]string{`assertion.ref=="refs/heads/main"`}, nil},
+		{[]string{`assertion.event_name!='pull_request'`}, []string{`assertion.event_name != "pull_request"`}},
+		{[]string{`assertion.ref=='refs/heads/main'`, `assertion.environment in ['prod']`}, []string{`assertion.environment in ["prod"]`}},
+	}
+	for _, tt := range tests {
+		if got := missingConditionClauses(condition, tt.clauses); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("missingConditionClauses(%q) = %q, want %q", tt.clauses, got, tt.want)
+		}
+	}
+}
+
+func TestReadOnboardFile(t *testing.T) {
+	want := []onboardRow{
+		{line: 2, owner: "org-a", repo: "api", conditions: []string{"main-only", "protected-environments=staging|prod"}, serviceAccount: "deploy", createServiceAccount: true},
+		{line: 3, owner: "org-a", repo: "web", provider: "web", serviceAccount: "web@p.iam.gserviceaccount.com", attribute: "workflow", value: "deploy"},
+	}
+	files := map[string]string{
+		"repos.csv": `owner,repo,provider,conditions,service_account,create_service_account,attribute,value
+org-a,api,,main-only;protected-environments=staging|prod,deploy,true,,
+org-a,web,web,,web@p.iam.gserviceaccount.com,,workflow,deploy
+`,
+		"repos.yaml": `
+- {owner: org-a, repo: api, conditions: [main-only, protected-environments=staging|prod], service_account: deploy, create_service_account: true}
+- {owner: org-a, repo: web, provider: web, service_account: web@p.iam.gserviceaccount.com, attribute: workflow, value: deploy}
+`,
+	}
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		rows, err := readOnboardFile(path)
+		if err != nil {
+			t.Fatalf("readOnboardFile(%s) failed: %v", name, err)
+		}
+		if !reflect.DeepEqual(rows, want) {
+			t.Errorf("readOnboardFile(%s) = %+v\nwant %+v", name, rows, want)
+		}
+	}
+
+	invalid := map[string]string{
+		"unknown.yaml":  "- {owner: org-a, repo: api, service_account: deploy, branch: main}\n",
+		"missing.yaml":  "- {owner: org-a, service_account: deploy}\n",
+		"scalar.yml":    "- org-a/api\n",
+		"unknown.csv":   "owner,repo,service_account,branch\norg-a,api,deploy,main\n",
+		"missing.csv":   "owner,repo,service_account\norg-a,,deploy\n",
+		"bad-bool.yaml": "- {owner: org-a, repo: api, service_account: deploy, create_service_account: maybe}\n",
+	}
+	for name, content := range invalid {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := readOnboardFile(path); err == nil {
+			t.Errorf("readOnboardFile(%s) succeeded, want an error", name)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// conditionPreset is a named hardening clause that composes with the repository conditions of a provider
+type conditionPreset struct {
+	name        string
+	description string
+	// requiresValues is set for presets needing values given as name=a|b, they prompt when there are none
+	requiresValues bool
+	// condition builds the clause from the values given as name=a|b
+	condition func(values []string) (string, error)
+}
+
+// selectedPreset is a preset with the values it was selected with
+type selectedPreset struct {
+	conditionPreset
+	values []string
+}
+
+func (p selectedPreset) Condition() (string, error) {
+	return p.condition(p.values)
+}
+
+var conditionPresets = []conditionPreset{
+	{
+		name:        "main-only",
+		description: "only jobs running on the main branch",
+		condition: func([]string) (string, error) {
+			return celClaimEquals("ref", "refs/heads/main"), nil
+		},
+	},
+	{
+		name:        "release-tags",
+		description: "only jobs running on release tags (refs/tags/v*)",
+		condition: func([]string) (string, error) {
+			return "assertion.ref.startsWith(" + celString("refs/tags/v") + ")", nil
+		},
+	},
+	{
+		name:        "no-pull-request",
+		description: "reject jobs triggered by pull_request events",
+		condition: func([]string) (string, error) {
+			return "assertion.event_name!=" + celString("pull_request"), nil
+		},
+	},
+	{
+		name:           "protected-environments",
+		description:    "only jobs deploying to the named environments (configure protection rules for them in GitHub)",
+		requiresValues: true,
+		condition: func(environments []string) (string, error) {
+			if len(environments) == 0 {
+				input := GetInput("Enter protected environment names (comma separated):")
+				for _, env := range strings.Split(input, ",") {
+					if env = strings.TrimSpace(env); env != "" {
+						environments = append(environments, env)
+					}
+				}
+			}
+			if len(environments) == 0 {
+				return "", fmt.Errorf("at least one environment is required for the protected-environments preset")
+			}
+			quoted := make([]string, len(environments))
+			for i, env := range environments {
+				quoted[i] = celString(env)
+			}
+			return "assertion.environment in [" + strings.Join(quoted, ", ") + "]", nil
+		},
+	},
+	{
+		name:        "no-pull-request-target",
+		description: "reject pull_request_target events, which can run code from fork pull requests with access to the OIDC token (tokens carry no fork claim, so forks can't be detected directly)",
+		condition: func([]string) (string, error) {
+			return "assertion.event_name!=" + celString("pull_request_target"), nil
+		},
+	},
+}
+
+// SelectConditionPresets returns the presets named by flag, or lets the user pick them from a menu
+func SelectConditionPresets(names []string) ([]selectedPreset, error) {
+	if len(names) > 0 {
+		return ParseConditionPresets(names)
+	}
+
+	fmt.Println()
+	fmt.Println("Available condition presets:")
+	for i, preset := range conditionPresets {
+		fmt.Printf("%d. %s - %s\n", i+1, preset.name, preset.description)
+	}
+
+	for {
+		input := GetInput(fmt.Sprintf("Enter numbers (1-%d) separated by commas, or leave empty for none:", len(conditionPresets)))
+		if strings.TrimSpace(input) == "" {
+			return nil, nil
+		}
+
+		var selected []selectedPreset
+		valid := true
+		for _, field := range strings.Split(input, ",") {
+			var num int
+			if _, err := fmt.Sscanf(strings.TrimSpace(field), "%d", &num); err != nil || num < 1 || num > len(conditionPresets) {
+				fmt.Printf("Invalid input. Please enter numbers between 1 and %d\n", len(conditionPresets))
+				valid = false
+				break
+			}
+			selected = append(selected, selectedPreset{conditionPreset: conditionPresets[num-1]})
+		}
+		if valid {
+			return selected, nil
+		}
+	}
+}
+
+// ParseConditionPresets looks up presets by name, values are given as name=a|b
+// e.g. protected-environments=staging|prod
+func ParseConditionPresets(names []string) ([]selectedPreset, error) {
+	var selected []selectedPreset
+	for _, name := range names {
+		name, values, hasValues := strings.Cut(strings.TrimSpace(name), "=")
+		preset, ok := findConditionPreset(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown condition preset: %s (available: %s)", name, strings.Join(conditionPresetNames(), ", "))
+		}
+		p := selectedPreset{conditionPreset: preset}
+		if hasValues {
+			for _, value := range strings.Split(values, "|") {
+				if value = strings.TrimSpace(value); value != "" {
+					p.values = append(p.values, value)
+				}
+			}
+		}
+		selected = append(selected, p)
+	}
+	return selected, nil
+}
+
+func findConditionPreset(name string) (conditionPreset, bool) {
+	for _, preset := range conditionPresets {
+		if preset.name == name {
+			return preset, true
+		}
+	}
+	return conditionPreset{}, false
+}
+
+func conditionPresetNames() []string {
+	names := make([]string, len(conditionPresets))
+	for i, preset := range conditionPresets {
+		names[i] = preset.name
+	}
+	return names
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// RenderScript renders the setup as an idempotent bash script of the gcloud commands gwif runs,
+// guarding every create with a describe the way CreatePool and CreateProvider do
+func RenderScript(s *Setup) string {
+	var b strings.Builder
+	b.WriteString("#!/usr/bin/env bash\n")
+	fmt.Fprintf(&b, "# Workload identity pool %s in project %s, exported by gwif.\n", s.PoolID, s.ProjectID)
+	b.WriteString("# Safe to run repeatedly: existing pools and providers are skipped and bindings are only added once.\n")
+	b.WriteString("set -euo pipefail\n")
+
+	fmt.Fprintf(&b, "\n# Pool %s\n", s.PoolID)
+	poolArgs := recreatePoolArgs(s.ProjectID, s.PoolID, s.Pool)
+	writeGuardedCreate(&b, "pool "+s.PoolID,
+		[]string{"iam", "workload-identity-pools", "describe", s.PoolID, "--project", s.ProjectID, "--location", "global"},
+		poolArgs)
+
+	for _, provider := range s.Providers {
+		fmt.Fprintf(&b, "\n# Provider %s\n", provider.ID())
+		if provider.AttributeCondition != "" {
+			// Conditions can span lines, each needs its own # to stay a comment
+			fmt.Fprintf(&b, "# Condition: %s\n", strings.ReplaceAll(provider.AttributeCondition, "\n", "\n# "))
+		}
+
+		mappings := make([]attributeMapping, 0, len(provider.AttributeMapping))
+		for _, key := range slices.Sorted(maps.Keys(provider.AttributeMapping)) {
+			mappings = append(mappings, attributeMapping{key, provider.AttributeMapping[key]})
+		}
+		args := createProviderArgs(s.ProjectID, s.PoolID, provider.ID(), provider.DisplayName,
+			formatAttributeMapping(mappings), provider.AttributeCondition, provider.Oidc.IssuerURI)
+		if len(provider.Oidc.AllowedAudiences) > 0 {
+			args = append(args, "--allowed-audiences", strings.Join(provider.Oidc.AllowedAudiences, ","))
+		}
+		if provider.Disabled {
+			args = append(args, "--disabled")
+		}
+		writeGuardedCreate(&b, "provider "+provider.ID(),
+			[]string{"iam", "workload-identity-pools", "providers", "describe", provider.ID(),
+				"--project", s.ProjectID, "--location", "global", "--workload-identity-pool", s.PoolID},
+			args)
+	}
+
+	for i, binding := range s.Bindings {
+		fmt.Fprintf(&b, "\n# %s can use %s via %s\n", binding.Principal, binding.ServiceAccount, strings.TrimPrefix(binding.Role, "roles/"))
+		args := addBindingArgs(serviceAccountEmailProject(binding.ServiceAccount, s.ProjectID), binding.ServiceAccount, binding.Role, binding.Member)
+		args = append(args, "--format", "none")
+		if binding.Condition == nil {
+			// An explicit None keeps gcloud from prompting when the policy has conditional bindings
+			args = append(args, "--condition", "None")
+			fmt.Fprintf(&b, "gcloud %s\n", shellJoin(args))
+			continue
+		}
+
+		// Condition expressions may contain commas, which --condition can't express, so pass them as a file
+		var condition strings.Builder
+		encoder := json.NewEncoder(&condition)
+		encoder.SetEscapeHTML(false)
+		// Encoding a struct of strings can't fail
+		_ = encoder.Encode(binding.Condition)
+		file := fmt.Sprintf("condition_%d", i+1)
+		fmt.Fprintf(&b, "%s=$(mktemp)\n", file)
+		fmt.Fprintf(&b, "cat > \"$%s\" <<'EOF'\n%sEOF\n", file, condition.String())
+		fmt.Fprintf(&b, "gcloud %s --condition-from-file \"$%s\"\n", shellJoin(args), file)
+		fmt.Fprintf(&b, "rm -f \"$%s\"\n", file)
+	}
+	return b.String()
+}
+
+// writeGuardedCreate writes a create command that only runs when describe fails
+func writeGuardedCreate(b *strings.Builder, what string, describeArgs, createArgs []string) {
+	fmt.Fprintf(b, "if gcloud %s --format 'value(name)' >/dev/null 2>&1; then\n", shellJoin(describeArgs))
+	fmt.Fprintf(b, "  echo %s\n", shellQuote(fmt.Sprintf("%s already exists... skipping", what)))
+	b.WriteString("else\n")
+	// One flag per line keeps long mappings and conditions reviewable
+	var lines []string
+	for i, word := range shellWords(createArgs) {
+		if i == 0 || strings.HasPrefix(createArgs[i], "--") {
+			lines = append(lines, word)
+			continue
+		}
+		lines[len(lines)-1] += " " + word
+	}
+	fmt.Fprintf(b, "  gcloud %s\n", strings.Join(lines, " \\\n    "))
+	b.WriteString("fi\n")
+}
+
+var shellSafe = regexp.MustCompile(`^[a-zA-Z0-9_./:@=,+-]+$`)
+
+// shellQuote quotes s for bash when needed, single quotes keep CEL expressions verbatim
+func shellQuote(s string) string {
+	if shellSafe.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func shellWords(args []string) []string {
+	words := make([]string, len(args))
+	for i, arg := range args {
+		words[i] = shellQuote(arg)
+	}
+	return words
+}
+
+func shellJoin(args []string) string {
+	return strings.Join(shellWords(args), " ")
+}
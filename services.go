@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// requiredServices are the Google APIs Workload Identity Federation depends on
+var requiredServices = []string{
+	"iam.googleapis.com",
+	"iamcredentials.googleapis.com",
+	"sts.googleapis.com",
+	"cloudresourcemanager.googleapis.com",
+}
+
+// ListEnabledServices returns the set of APIs enabled in a project
+func ListEnabledServices(projectID string) (map[string]bool, error) {
+	cmd := gcloudCommand("services", "list",
+		"--enabled",
+		"--project", projectID,
+		"--format", "value(config.name)")
+	output, err := outputGcloud("list enabled services", cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	enabled := map[string]bool{}
+	for _, service := range strings.Fields(string(output)) {
+		enabled[service] = true
+	}
+	return enabled, nil
+}
+
+// EnsureRequiredServices offers to enable the required APIs that are disabled in the project
+func EnsureRequiredServices(cfg *config) error {
+	if cfg.skipAPICheck {
+		return nil
+	}
+
+	enabled, err := ListEnabledServices(cfg.projectID)
+	if err != nil {
+		return fmt.Errorf("%v (use --skip-api-check to skip this check)", err)
+	}
+
+	var missing []string
+	for _, service := range requiredServices {
+		if !enabled[service] {
+			missing = append(missing, service)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	fmt.Printf("The following APIs are required but not enabled in project %s:\n", cfg.projectID)
+	for _, service := range missing {
+		fmt.Printf("- %s\n", service)
+	}
+	if !Ask("Enable them now?") {
+		return fmt.Errorf("required APIs are not enabled: %s", strings.Join(missing, ", "))
+	}
+
+	// gcloud waits for the enable operation to finish unless --async is passed
+	args := append([]string{"services", "enable"}, missing...)
+	cmd := gcloudCommand(append(args, "--project", cfg.projectID)...)
+	if err := runGcloud("enable APIs", cmd); err != nil {
+		return err
+	}
+	fmt.Println("APIs enabled successfully.")
+	return nil
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// LoadTokenClaims reads the claims from a GitHub OIDC token file or a JSON claims file.
+// The token signature is not verified, only its payload is decoded.
+func LoadTokenClaims(tokenFile, claimsFile string) (map[string]any, error) {
+	var payload []byte
+	switch {
+	case tokenFile != "" && claimsFile != "":
+		return nil, fmt.Errorf("use either --token or --claims, not both")
+	case tokenFile != "":
+		token, err := os.ReadFile(tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read token: %v", err)
+		}
+		parts := strings.Split(strings.TrimSpace(string(token)), ".")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("invalid token: expected a JWT with 3 parts, got %d", len(parts))
+		}
+		payload, err = base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+		if err != nil {
+			return nil, fmt.Errorf("invalid token payload: %v", err)
+		}
+	case claimsFile != "":
+		var err error
+		payload, err = os.ReadFile(claimsFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read claims: %v", err)
+		}
+	default:
+		return nil, fmt.Errorf("a token (--token) or claims file (--claims) is required")
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	var raw map[string]any
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("invalid claims: %v", err)
+	}
+
+	// CEL only knows int64 numbers, timestamps like iat and exp are whole seconds
+	claims := make(map[string]any, len(raw))
+	for key, value := range raw {
+		if n, ok := value.(json.Number); ok {
+			if i, err := n.Int64(); err == nil {
+				claims[key] = i
+				continue
+			}
+			claims[key] = n.String()
+			continue
+		}
+		claims[key] = value
+	}
+	return claims, nil
+}
+
+// MappingResult holds the identity a provider attribute mapping produces for a token
+type MappingResult struct {
+	Subject    string
+	Attributes map[string]any
+	// Errors holds the mappings that failed, by key, e.g. for claims missing from the token
+	Errors map[string]error
+}
+
+// EvaluateMapping applies a provider attribute mapping to token claims
+func EvaluateMapping(mapping map[string]string, claims map[string]any) MappingResult {
+	return evaluateMapping(mapping, &celActivation{assertion: claims})
+}
+
+func evaluateMapping(mapping map[string]string, act *celActivation) MappingResult {
+	result := MappingResult{Attributes: map[string]any{}, Errors: map[string]error{}}
+	for key, expression := range mapping {
+		v, err := evalCEL(expression, false, act)
+		if err != nil {
+			result.Errors[key] = err
+			continue
+		}
+		switch {
+		case key == "google.subject":
+			result.Subject = fmt.Sprint(v)
+		case strings.HasPrefix(key, "attribute."):
+			result.Attributes[strings.TrimPrefix(key, "attribute.")] = v
+		}
+	}
+	return result
+}
+
+// EvaluateCondition evaluates a provider attribute condition against token claims and mapped attributes
+func EvaluateCondition(condition string, claims map[string]any, mapped MappingResult) (bool, error) {
+	return evaluateCondition(condition, &celActivation{
+		assertion: claims,
+		attribute: mapped.Attributes,
+		google:    map[string]any{"subject": mapped.Subject},
+	})
+}
+
+func evaluateCondition(condition string, act *celActivation) (bool, error) {
+	if condition == "" {
+		return true, nil
+	}
+	v, err := evalCEL(condition, true, act)
+	if err != nil {
+		return false, err
+	}
+	passed, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("condition evaluated to %v, not true or false", v)
+	}
+	return passed, nil
+}
+
+// Simulate evaluates a provider against token claims the way Google STS would on a token exchange
+func Simulate(cfg *config, projectNumber string, claims map[string]any) error {
+	provider, err := GetProvider(cfg.projectID, cfg.poolName, cfg.providerName)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Provider: %s\n", provider.Name)
+	if provider.State == "DELETED" {
+		fmt.Println("WARNING: provider is deleted - every token exchange will fail")
+	}
+	if provider.Disabled {
+		fmt.Println("WARNING: provider is disabled - every token exchange will fail")
+	}
+
+	fmt.Println()
+	fmt.Println("Token:")
+	if iss, _ := claims["iss"].(string); iss != provider.Oidc.IssuerURI {
+		fmt.Printf("  [FAIL] issuer %q does not match the provider issuer %q\n", iss, provider.Oidc.IssuerURI)
+	} else {
+		fmt.Printf("  [PASS] issuer %s\n", iss)
+	}
+
+	// Without allowed audiences the provider accepts its own full resource name
+	audiences := provider.Oidc.AllowedAudiences
+	if len(audiences) == 0 {
+		audiences = []string{"https://iam.googleapis.com/" + provider.Name}
+	}
+	if aud, _ := claims["aud"].(string); !slices.Contains(audiences, aud) {
+		fmt.Printf("  [FAIL] audience %q is not allowed, expected one of: %s\n", aud, strings.Join(audiences, ", "))
+	} else {
+		fmt.Printf("  [PASS] audience %s\n", aud)
+	}
+	if exp, ok := claims["exp"].(int64); ok && time.Unix(exp, 0).Before(time.Now()) {
+		fmt.Printf("  [INFO] token expired at %s (ignored by the simulation)\n", time.Unix(exp, 0).UTC().Format(time.RFC3339))
+	}
+
+	mapped := EvaluateMapping(provider.AttributeMapping, claims)
+
+	fmt.Println()
+	fmt.Println("Attribute mapping:")
+	keys := slices.Sorted(maps.Keys(provider.AttributeMapping))
+	for _, key := range keys {
+		if err, failed := mapped.Errors[key]; failed {
+			fmt.Printf("  %s = (not set: %v)\n", key, err)
+			continue
+		}
+		if key == "google.subject" {
+			fmt.Printf("  %s = %s\n", key, mapped.Subject)
+			continue
+		}
+		fmt.Printf("  %s = %v\n", key, mapped.Attributes[strings.TrimPrefix(key, "attribute.")])
+	}
+	if _, failed := mapped.Errors["google.subject"]; failed {
+		fmt.Println("  [FAIL] google.subject could not be mapped - every token exchange will fail")
+	}
+
+	fmt.Println()
+	fmt.Println("Attribute condition:")
+	fmt.Printf("  %s\n", provider.AttributeCondition)
+	passed, conditionErr := EvaluateCondition(provider.AttributeCondition, claims, mapped)
+	switch {
+	case conditionErr != nil:
+		fmt.Printf("  [FAIL] condition could not be evaluated, which rejects the token: %v\n", conditionErr)
+	case passed:
+		fmt.Println("  [PASS] condition admits the token")
+	default:
+		fmt.Println("  [FAIL] condition rejects the token")
+	}
+
+	bindings, err := ListWorkloadIdentityBindings(bindingProjects(cfg)...)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	fmt.Println("Matching service account bindings:")
+	// Bindings with an IAM condition only grant access while it holds, e.g. until they expire
+	var matched, denied, conditional []string
+	now := time.Now()
+	for _, binding := range bindings {
+		p := binding.Principal
+		if binding.Role != workloadIdentityUserRole || p.ProjectNumber != projectNumber || p.Pool != cfg.poolName {
+			continue
+		}
+		if !p.Matches(mapped.Subject, mapped.Attributes) {
+			continue
+		}
+		line := fmt.Sprintf("  %s via %s", binding.ServiceAccount, p)
+		if binding.Condition == nil {
+			matched = append(matched, line)
+			continue
+		}
+		granted, err := evalIAMCondition(binding.Condition.Expression, now)
+		switch {
+		case err != nil:
+			conditional = append(conditional, fmt.Sprintf("%s if %s", line, binding.Condition.Expression))
+		case granted:
+			matched = append(matched, fmt.Sprintf("%s while %s", line, binding.Condition.Expression))
+		default:
+			if expires, ok := bindingExpiry(binding); ok {
+				denied = append(denied, fmt.Sprintf("%s (%s)", line, formatValidity(expires, now)))
+			} else {
+				denied = append(denied, fmt.Sprintf("%s (condition is false: %s)", line, binding.Condition.Expression))
+			}
+		}
+	}
+	sort.Strings(matched)
+	for _, line := range matched {
+		fmt.Println(line)
+	}
+	if len(matched) == 0 {
+		fmt.Println("  none - the token can't impersonate any service account in this project")
+	} else if conditionErr != nil || !passed {
+		fmt.Println("  (these bindings only apply once the attribute condition admits the token)")
+	}
+
+	if len(conditional) > 0 {
+		fmt.Println()
+		fmt.Println("Conditional bindings, their IAM condition could not be evaluated here:")
+		sort.Strings(conditional)
+		for _, line := range conditional {
+			fmt.Println(line)
+		}
+	}
+	if len(denied) > 0 {
+		fmt.Println()
+		fmt.Println("Bindings that don't apply now, their IAM condition denies access:")
+		sort.Strings(denied)
+		for _, line := range denied {
+			fmt.Println(line)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// statusRef stands in for the unknown ref in candidate workflow_ref claims,
+// values derived from it aren't used to decide whether a binding matches
+const statusRef = "refs/heads/<unknown>"
+
+// statusPath is one chain from a provider to a service account the repository can reach
+type statusPath struct {
+	pool     string
+	provider string
+	binding  ServiceAccountBinding
+}
+
+// Status shows how a repository can reach the project: the providers whose condition admits it,
+// the service account bindings its tokens can match and the roles of those service accounts
+func Status(cfg *config, projectNumber string) error {
+	repository := cfg.githubRepositoryOwner + "/" + cfg.githubRepository
+
+	// Only the repository claims are known ahead of a token, everything else is evaluated as unknown
+	claims := map[string]any{
+		"iss":              githubIssuer,
+		"repository":       repository,
+		"repository_owner": cfg.githubRepositoryOwner,
+	}
+	if cfg.githubRepositoryOwnerID != "" {
+		claims["repository_owner_id"] = cfg.githubRepositoryOwnerID
+	}
+	if cfg.githubRepositoryID != "" {
+		claims["repository_id"] = cfg.githubRepositoryID
+	}
+	candidates := repositoryCandidateClaims(cfg, NewGitHubClient())
+
+	pools, err := ListPools(cfg.projectID, false)
+	if err != nil {
+		return err
+	}
+	bindings, err := ListWorkloadIdentityBindings(bindingProjects(cfg)...)
+	if err != nil {
+		return err
+	}
+	policy, err := GetProjectPolicy(cfg.projectID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Repository %s in project %s:\n", repository, cfg.projectID)
+
+	var paths []statusPath
+	var rejected []string
+	for _, pool := range pools {
+		providers, err := ListProviders(cfg.projectID, pool, false)
+		if err != nil {
+			return err
+		}
+		for _, providerName := range providers {
+			provider, err := GetProvider(cfg.projectID, pool, providerName)
+			if err != nil {
+				return err
+			}
+			if provider.Disabled {
+				rejected = append(rejected, fmt.Sprintf("%s > %s (disabled)", pool, providerName))
+				continue
+			}
+
+			mapped := evaluateMapping(provider.AttributeMapping, &celActivation{assertion: claims, partial: true})
+			google := map[string]any{}
+			if _, failed := mapped.Errors["google.subject"]; !failed {
+				google["subject"] = mapped.Subject
+			}
+			admitted, err := evaluateCondition(provider.AttributeCondition, &celActivation{
+				assertion: claims,
+				attribute: mapped.Attributes,
+				google:    google,
+				partial:   true,
+			})
+
+			var unknown *celUnknownError
+			admission := "admits the repository"
+			switch {
+			case errors.As(err, &unknown):
+				admission = "admits the repository for some tokens (" + unknown.Error() + ")"
+			case err != nil:
+				rejected = append(rejected, fmt.Sprintf("%s > %s (condition could not be evaluated: %v)", pool, providerName, err))
+				continue
+			case !admitted:
+				rejected = append(rejected, fmt.Sprintf("%s > %s", pool, providerName))
+				continue
+			}
+
+			fmt.Println()
+			fmt.Printf("Pool %s > provider %s\n", pool, providerName)
+			fmt.Printf("  %s\n", admission)
+			fmt.Printf("  condition: %s\n", provider.AttributeCondition)
+
+			values := candidateAttributeValues(provider.AttributeMapping, claims, candidates, mapped)
+			found := false
+			for _, binding := range bindings {
+				p := binding.Principal
+				if binding.Role != workloadIdentityUserRole || p.ProjectNumber != projectNumber || p.Pool != pool {
+					continue
+				}
+				match, ok := matchStatusBinding(p, repository, mapped, values)
+				if !ok {
+					continue
+				}
+				found = true
+				paths = append(paths, statusPath{pool: pool, provider: providerName, binding: binding})
+
+				fmt.Printf("  -> %s via %s (%s)\n", binding.ServiceAccount, p, match)
+				roles := policy.MemberRoles("serviceAccount:" + binding.ServiceAccount)
+				if len(roles) == 0 {
+					fmt.Println("     roles: none in this project")
+				} else {
+					fmt.Printf("     roles: %s\n", strings.Join(roles, ", "))
+				}
+			}
+			if !found {
+				fmt.Println("  -> no service account bindings match the repository")
+			}
+		}
+	}
+
+	if len(rejected) > 0 {
+		fmt.Println()
+		printImpact("Providers that reject the repository", rejected)
+	}
+
+	if len(paths) == 0 {
+		fmt.Println()
+		fmt.Println("The repository can't impersonate any service account in this project.")
+		return nil
+	}
+
+	for _, path := range paths {
+		fmt.Println()
+		fmt.Printf("# %s > %s > %s\n", path.pool, path.provider, path.binding.ServiceAccount)
+		pathCfg := *cfg
+		pathCfg.poolName = path.pool
+		pathCfg.providerName = path.provider
+		pathCfg.serviceAccount = path.binding.ServiceAccount
+		DumpYAML(&pathCfg, projectNumber)
+	}
+	return nil
+}
+
+// repositoryCandidateClaims returns claims for each workflow and environment of the repository,
+// used to work out which attribute values its tokens can carry. Lookup failures leave them unknown.
+func repositoryCandidateClaims(cfg *config, client GitHubClient) []map[string]any {
+	var candidates []map[string]any
+	repository := cfg.githubRepositoryOwner + "/" + cfg.githubRepository
+
+	workflows, err := client.Workflows(cfg.githubRepositoryOwner, cfg.githubRepository)
+	if err != nil {
+		fmt.Printf("Warning: %v - workflow bindings are shown as possible matches\n", err)
+	}
+	for _, path := range workflows {
+		candidates = append(candidates, map[string]any{"workflow_ref": fmt.Sprintf("%s/%s@%s", repository, path, statusRef)})
+	}
+
+	environments, err := client.Environments(cfg.githubRepositoryOwner, cfg.githubRepository)
+	if err != nil {
+		fmt.Printf("Warning: %v - environment bindings are shown as possible matches\n", err)
+	}
+	for _, environment := range environments {
+		candidates = append(candidates, map[string]any{"environment": environment})
+	}
+	return candidates
+}
+
+// candidateAttributeValues maps the attributes that candidate claims resolve to the values they can take
+func candidateAttributeValues(mapping map[string]string, claims map[string]any, candidates []map[string]any, mapped MappingResult) map[string]map[string]bool {
+	values := map[string]map[string]bool{}
+	for _, candidate := range candidates {
+		merged := make(map[string]any, len(claims)+len(candidate))
+		for key, value := range claims {
+			merged[key] = value
+		}
+		for key, value := range candidate {
+			merged[key] = value
+		}
+
+		result := evaluateMapping(mapping, &celActivation{assertion: merged, partial: true})
+		for attribute, value := range result.Attributes {
+			if _, known := mapped.Attributes[attribute]; known {
+				continue
+			}
+			s := fmt.Sprint(value)
+			if strings.Contains(s, statusRef) {
+				continue
+			}
+			if values[attribute] == nil {
+				values[attribute] = map[string]bool{}
+			}
+			values[attribute][s] = true
+		}
+	}
+	return values
+}
+
+// matchStatusBinding reports whether tokens of the repository can match the principal, and how
+func matchStatusBinding(p WorkloadPrincipal, repository string, mapped MappingResult, values map[string]map[string]bool) (string, bool) {
+	switch p.Kind {
+	case "all":
+		return "every identity in the pool", true
+	case "subject":
+		if _, failed := mapped.Errors["google.subject"]; !failed {
+			return "subject matches", mapped.Subject == p.Value
+		}
+		// GitHub subjects start with repo:<owner>/<repo>:
+		if strings.HasPrefix(p.Value, "repo:"+repository+":") {
+			return "subject of the repository, depends on the job", true
+		}
+		return "", false
+	case "attribute":
+		if v, known := mapped.Attributes[p.Attribute]; known {
+			return "matches the repository", fmt.Sprint(v) == p.Value
+		}
+		var unknown *celUnknownError
+		if !errors.As(mapped.Errors["attribute."+p.Attribute], &unknown) {
+			// Not mapped by the provider, or the mapping fails
+			return "", false
+		}
+		if candidates, ok := values[p.Attribute]; ok {
+			return fmt.Sprintf("the repository has this %s", p.Attribute), candidates[p.Value]
+		}
+		return "could match, " + unknown.Error(), true
+	}
+	return "", false
+}
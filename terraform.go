@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// RenderTerraform renders the setup as Terraform resources with import blocks,
+// so the live resources can be adopted without recreating them
+func RenderTerraform(s *Setup) string {
+	var b strings.Builder
+	names := newUniqueNames("_")
+	fmt.Fprintf(&b, "# Workload identity pool %s in project %s, exported by gwif\n", s.PoolID, s.ProjectID)
+
+	pool := names.get(identifierName(s.PoolID))
+	poolAddress := "google_iam_workload_identity_pool." + pool
+	fmt.Fprintf(&b, "\nresource \"google_iam_workload_identity_pool\" %q {\n", pool)
+	writeHCLAttributes(&b, "  ", [][2]string{
+		{"project", hclString(s.ProjectID)},
+		{"workload_identity_pool_id", hclString(s.PoolID)},
+		{"display_name", hclOptionalString(s.Pool.DisplayName)},
+		{"description", hclOptionalString(s.Pool.Description)},
+		{"disabled", hclOptionalBool(s.Pool.Disabled)},
+	})
+	b.WriteString("}\n")
+	writeImportBlock(&b, poolAddress, fmt.Sprintf("projects/%s/locations/global/workloadIdentityPools/%s", s.ProjectID, s.PoolID))
+
+	for _, provider := range s.Providers {
+		name := names.get(identifierName(s.PoolID, provider.ID()))
+		address := "google_iam_workload_identity_pool_provider." + name
+		fmt.Fprintf(&b, "\nresource \"google_iam_workload_identity_pool_provider\" %q {\n", name)
+		writeHCLAttributes(&b, "  ", [][2]string{
+			{"project", hclString(s.ProjectID)},
+			{"workload_identity_pool_id", poolAddress + ".workload_identity_pool_id"},
+			{"workload_identity_pool_provider_id", hclString(provider.ID())},
+			{"display_name", hclOptionalString(provider.DisplayName)},
+			{"disabled", hclOptionalBool(provider.Disabled)},
+			{"attribute_condition", hclOptionalString(provider.AttributeCondition)},
+		})
+
+		b.WriteString("  attribute_mapping = {\n")
+		var mapping [][2]string
+		for _, key := range slices.Sorted(maps.Keys(provider.AttributeMapping)) {
+			mapping = append(mapping, [2]string{hclString(key), hclString(provider.AttributeMapping[key])})
+		}
+		writeHCLAttributes(&b, "    ", mapping)
+		b.WriteString("  }\n")
+
+		b.WriteString("  oidc {\n")
+		oidc := [][2]string{{"issuer_uri", hclString(provider.Oidc.IssuerURI)}}
+		if len(provider.Oidc.AllowedAudiences) > 0 {
+			audiences := make([]string, len(provider.Oidc.AllowedAudiences))
+			for i, audience := range provider.Oidc.AllowedAudiences {
+				audiences[i] = hclString(audience)
+			}
+			oidc = append(oidc, [2]string{"allowed_audiences", "[" + strings.Join(audiences, ", ") + "]"})
+		}
+		writeHCLAttributes(&b, "    ", oidc)
+		b.WriteString("  }\n")
+		b.WriteString("}\n")
+		writeImportBlock(&b, address, fmt.Sprintf("projects/%s/locations/global/workloadIdentityPools/%s/providers/%s", s.ProjectID, s.PoolID, provider.ID()))
+	}
+
+	for _, binding := range s.Bindings {
+		account, _, _ := strings.Cut(binding.ServiceAccount, "@")
+		name := names.get(identifierName(account, binding.Principal.Kind, binding.Principal.Attribute, binding.Principal.Value))
+		address := "google_service_account_iam_member." + name
+		serviceAccount := s.ServiceAccountResource(binding.ServiceAccount)
+
+		fmt.Fprintf(&b, "\n# %s\n", binding.Principal)
+		fmt.Fprintf(&b, "resource \"google_service_account_iam_member\" %q {\n", name)
+		writeHCLAttributes(&b, "  ", [][2]string{
+			{"service_account_id", hclString(serviceAccount)},
+			{"role", hclString(binding.Role)},
+			{"member", hclString(binding.Member)},
+		})
+		importID := fmt.Sprintf("%s %s %s", serviceAccount, binding.Role, binding.Member)
+		if binding.Condition != nil {
+			b.WriteString("  condition {\n")
+			writeHCLAttributes(&b, "    ", [][2]string{
+				{"title", hclString(binding.Condition.Title)},
+				{"description", hclOptionalString(binding.Condition.Description)},
+				{"expression", hclString(binding.Condition.Expression)},
+			})
+			b.WriteString("  }\n")
+			importID += " " + binding.Condition.Title
+		}
+		b.WriteString("}\n")
+		writeImportBlock(&b, address, importID)
+	}
+	return b.String()
+}
+
+// writeHCLAttributes writes name = value lines aligned like terraform fmt, skipping empty values
+func writeHCLAttributes(b *strings.Builder, indent string, attributes [][2]string) {
+	width := 0
+	for _, a := range attributes {
+		if a[1] != "" && len(a[0]) > width {
+			width = len(a[0])
+		}
+	}
+	for _, a := range attributes {
+		if a[1] != "" {
+			fmt.Fprintf(b, "%s%-*s = %s\n", indent, width, a[0], a[1])
+		}
+	}
+}
+
+func writeImportBlock(b *strings.Builder, address, id string) {
+	fmt.Fprintf(b, "\nimport {\n  to = %s\n  id = %s\n}\n", address, hclString(id))
+}
+
+// hclString quotes s as an HCL string, escaping template sequences so CEL is kept verbatim
+func hclString(s string) string {
+	return `"` + strings.NewReplacer(
+		`\`, `\\`,
+		`"`, `\"`,
+		"\n", `\n`,
+		"\r", `\r`,
+		"\t", `\t`,
+		"${", "$${",
+		"%{", "%%{",
+	).Replace(s) + `"`
+}
+
+// hclOptionalString returns an empty value, which writeHCLAttributes skips, for empty strings
+func hclOptionalString(s string) string {
+	if s == "" {
+		return ""
+	}
+	return hclString(s)
+}
+
+func hclOptionalBool(v bool) string {
+	if !v {
+		return ""
+	}
+	return "true"
+}
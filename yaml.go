@@ -1,22 +1,37 @@
 package main
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 func DumpYAML(cfg *config, projectNumber string) {
-	fmt.Println(`
+	fmt.Println(workflowYAML(cfg, projectNumber))
+}
+
+// workflowYAML returns the GitHub Actions steps authenticating with the configured provider and service account
+func workflowYAML(cfg *config, projectNumber string) string {
+	steps := strings.TrimSuffix(workflowSteps(cfg, projectNumber), "\n")
+	return `
  <-- in your workspace -->
  permissions:
   id-token: write # This is required for requesting the JWT from GCP Workload Identity
 
  <-- in your job steps -->
-      - name: 'Authenticate to Google Cloud'
-        uses: 'google-github-actions/auth@v2'
-        with:
-          project_id: '` + cfg.projectID + `'
-          workload_identity_provider: 'projects/` + projectNumber + `/locations/global/workloadIdentityPools/` + cfg.poolName + `/providers/` + cfg.providerName + `'
-          service_account: '` + cfg.serviceAccount + `'
-          access_token_lifetime: '300s' # optional, default: '3600s' (1 hour)
-      - name: 'Set up Cloud SDK'
-        uses: 'google-github-actions/setup-gcloud@v2'
-`)
+      ` + strings.ReplaceAll(steps, "\n", "\n      ") + `
+`
+}
+
+// workflowSteps returns the job steps of workflowYAML as a YAML document
+func workflowSteps(cfg *config, projectNumber string) string {
+	return `- name: 'Authenticate to Google Cloud'
+  uses: 'google-github-actions/auth@v2'
+  with:
+    project_id: '` + serviceAccountProjectID(cfg) + `'
+    workload_identity_provider: 'projects/` + projectNumber + `/locations/global/workloadIdentityPools/` + cfg.poolName + `/providers/` + cfg.providerName + `'
+    service_account: '` + cfg.serviceAccount + `'
+    access_token_lifetime: '300s' # optional, default: '3600s' (1 hour)
+- name: 'Set up Cloud SDK'
+  uses: 'google-github-actions/setup-gcloud@v2'
+`
 }